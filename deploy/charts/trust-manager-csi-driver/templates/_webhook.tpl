@@ -0,0 +1,121 @@
+{{/*
+Deployment and Service of an admission webhook, called with a dict of
+"root" (the chart context), "kind" (validating or mutating), "args" (extra
+arguments), "volumes" and "volumeMounts".
+*/}}
+{{- define "trust-manager-csi-driver.webhook" -}}
+{{- $root := .root -}}
+{{- $kind := .kind -}}
+{{- $args := .args -}}
+{{- $volumes := .volumes -}}
+{{- $volumeMounts := .volumeMounts -}}
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{ include "trust-manager-csi-driver.name" $root }}-{{ $kind }}-webhook
+  namespace: {{ $root.Release.Namespace | quote }}
+  labels:
+    {{- include "trust-manager-csi-driver.labels" $root | nindent 4 }}
+spec:
+  replicas: {{ $root.Values.webhook.replicaCount }}
+  selector:
+    matchLabels:
+      app: {{ include "trust-manager-csi-driver.name" $root }}-{{ $kind }}-webhook
+  template:
+    metadata:
+      labels:
+        app: {{ include "trust-manager-csi-driver.name" $root }}-{{ $kind }}-webhook
+        {{- include "trust-manager-csi-driver.labels" $root | nindent 8 }}
+        {{- with $root.Values.podLabels }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+    spec:
+      securityContext:
+        runAsNonRoot: true
+        runAsUser: 65532
+        seccompProfile: { type: RuntimeDefault }
+      {{- with $root.Values.imagePullSecrets }}
+      imagePullSecrets:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      serviceAccountName: {{ include "trust-manager-csi-driver.name" $root }}-webhook
+      {{- with $root.Values.priorityClassName }}
+      priorityClassName: {{ . | quote }}
+      {{- end }}
+      containers:
+        - name: webhook
+          securityContext:
+            allowPrivilegeEscalation: false
+            capabilities: { drop: [ "ALL" ] }
+            readOnlyRootFilesystem: true
+          image: "{{ template "image" (tuple $root.Values.image $root.Chart.AppVersion) }}"
+          imagePullPolicy: {{ $root.Values.image.pullPolicy }}
+          args:
+            - {{ $kind }}-webhook
+            - --log-level={{ $root.Values.app.logLevel }}
+            - --driver-name={{ $root.Values.app.driver.name }}
+            - --webhook-port={{ $root.Values.webhook.port }}
+            - --webhook-cert-dir=/tls
+            {{- with $args }}
+            {{- toYaml . | nindent 12 }}
+            {{- end }}
+            {{- if $root.Values.metrics.enabled }}
+            - --metrics-bind-address=:{{ $root.Values.metrics.port }}
+            {{- else }}
+            - --metrics-bind-address=0
+            {{- end }}
+          ports:
+            - containerPort: {{ $root.Values.webhook.port }}
+              name: webhook
+            - containerPort: 6060
+              name: readyz
+            {{- if $root.Values.metrics.enabled }}
+            - containerPort: {{ $root.Values.metrics.port }}
+              name: http-metrics
+            {{- end }}
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: readyz
+            initialDelaySeconds: 3
+            periodSeconds: 7
+          volumeMounts:
+            - name: tls
+              mountPath: /tls
+              readOnly: true
+            {{- with $volumeMounts }}
+            {{- toYaml . | nindent 12 }}
+            {{- end }}
+          {{- with $root.Values.webhook.resources }}
+          resources:
+            {{- toYaml . | nindent 12 }}
+          {{- end }}
+      {{- with $root.Values.nodeSelector }}
+      nodeSelector:
+        {{- toYaml . | nindent 8 }}
+      {{- end }}
+      volumes:
+        - name: tls
+          secret:
+            secretName: {{ include "trust-manager-csi-driver.name" $root }}-webhook-tls
+        {{- with $volumes }}
+        {{- toYaml . | nindent 8 }}
+        {{- end }}
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: {{ include "trust-manager-csi-driver.name" $root }}-{{ $kind }}-webhook
+  namespace: {{ $root.Release.Namespace | quote }}
+  labels:
+    {{- include "trust-manager-csi-driver.labels" $root | nindent 4 }}
+spec:
+  type: ClusterIP
+  ports:
+    - port: 443
+      targetPort: webhook
+      protocol: TCP
+      name: webhook
+  selector:
+    app: {{ include "trust-manager-csi-driver.name" $root }}-{{ $kind }}-webhook
+{{- end }}
@@ -31,27 +31,64 @@ type Metadata struct {
 	VolumeID string
 	// PodNamespace is the namespace of the pod being mounted into
 	PodNamespace string
+	// PodName is the name of the pod being mounted into
+	PodName string
+	// PodUID is the UID of the pod being mounted into
+	PodUID string
+	// PodServiceAccount is the service account of the pod being mounted into
+	PodServiceAccount string
 	// Bundle is the trust bundle to mount
 	Bundle string
 	// Outputs defines the output formats
 	Outputs []Output
+	// CreationTimestamp is when the volume was published
+	CreationTimestamp metav1.Time
+	// LastSyncedHash is the hash of the bundle contents last written to the
+	// volume
+	LastSyncedHash string
+	// LastSyncedCertificates is the number of certificates last written to
+	// the volume
+	LastSyncedCertificates int
 }
 
 func (m Metadata) GetName() string {
 	return m.VolumeID
 }
 
+// PodKeysAndValues returns the identity of the pod the volume is mounted into
+// as key/value pairs for structured logging.
+func (m Metadata) PodKeysAndValues() []any {
+	return []any{
+		"pod_namespace", m.PodNamespace,
+		"pod_name", m.PodName,
+		"pod_uid", m.PodUID,
+		"service_account", m.PodServiceAccount,
+	}
+}
+
 // Output defines an output for a given CSI trust bundle mount
 type Output struct {
 	// Format to write the certificate bundle
 	Format OutputFormat
 	// Owner of the files
 	UID, GID *int64
+	// Mode of the files, if unset the files are only readable by the owner
+	// and group
+	Mode *int32
 	// Path to the file or directory.
 	// For outputs that produce a single file this must be a path to the file,
 	// outputs that produce multiple files this will be the path to the
 	// directory
 	Path string
+	// Filters select the certificates of the bundle written to the output,
+	// if unset every certificate is written
+	Filters *OutputFilters
+}
+
+// OutputFilters select the certificates of the bundle written to an output
+type OutputFilters struct {
+	// ExcludeExpired leaves out the certificates that have expired
+	ExcludeExpired bool
 }
 
 // OutputFormat defines the format to write the certificate bundle
@@ -0,0 +1,35 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/conversion"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+// Convert_metadata_Metadata_To_v1alpha1_Metadata drops the fields added in
+// later versions, v1alpha1 is only read and never written.
+func Convert_metadata_Metadata_To_v1alpha1_Metadata(in *metadata.Metadata, out *Metadata, s conversion.Scope) error {
+	return autoConvert_metadata_Metadata_To_v1alpha1_Metadata(in, out, s)
+}
+
+// Convert_metadata_Output_To_v1alpha1_Output drops the mode and filters added
+// in v1alpha2, v1alpha1 is only read and never written.
+func Convert_metadata_Output_To_v1alpha1_Output(in *metadata.Output, out *Output, s conversion.Scope) error {
+	return autoConvert_metadata_Output_To_v1alpha1_Output(in, out, s)
+}
@@ -40,17 +40,17 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*metadata.Metadata)(nil), (*Metadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_metadata_Metadata_To_v1alpha1_Metadata(a.(*metadata.Metadata), b.(*Metadata), scope)
+	if err := s.AddGeneratedConversionFunc((*Output)(nil), (*metadata.Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_Output_To_metadata_Output(a.(*Output), b.(*metadata.Output), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*Output)(nil), (*metadata.Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
-		return Convert_v1alpha1_Output_To_metadata_Output(a.(*Output), b.(*metadata.Output), scope)
+	if err := s.AddConversionFunc((*metadata.Metadata)(nil), (*Metadata)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_metadata_Metadata_To_v1alpha1_Metadata(a.(*metadata.Metadata), b.(*Metadata), scope)
 	}); err != nil {
 		return err
 	}
-	if err := s.AddGeneratedConversionFunc((*metadata.Output)(nil), (*Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
+	if err := s.AddConversionFunc((*metadata.Output)(nil), (*Output)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_metadata_Output_To_v1alpha1_Output(a.(*metadata.Output), b.(*Output), scope)
 	}); err != nil {
 		return err
@@ -62,7 +62,17 @@ func autoConvert_v1alpha1_Metadata_To_metadata_Metadata(in *Metadata, out *metad
 	out.VolumeID = in.VolumeID
 	out.PodNamespace = in.PodNamespace
 	out.Bundle = in.Bundle
-	out.Outputs = *(*[]metadata.Output)(unsafe.Pointer(&in.Outputs))
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]metadata.Output, len(*in))
+		for i := range *in {
+			if err := Convert_v1alpha1_Output_To_metadata_Output(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Outputs = nil
+	}
 	return nil
 }
 
@@ -74,16 +84,27 @@ func Convert_v1alpha1_Metadata_To_metadata_Metadata(in *Metadata, out *metadata.
 func autoConvert_metadata_Metadata_To_v1alpha1_Metadata(in *metadata.Metadata, out *Metadata, s conversion.Scope) error {
 	out.VolumeID = in.VolumeID
 	out.PodNamespace = in.PodNamespace
+	// WARNING: in.PodName requires manual conversion: does not exist in peer-type
+	// WARNING: in.PodUID requires manual conversion: does not exist in peer-type
+	// WARNING: in.PodServiceAccount requires manual conversion: does not exist in peer-type
 	out.Bundle = in.Bundle
-	out.Outputs = *(*[]Output)(unsafe.Pointer(&in.Outputs))
+	if in.Outputs != nil {
+		in, out := &in.Outputs, &out.Outputs
+		*out = make([]Output, len(*in))
+		for i := range *in {
+			if err := Convert_metadata_Output_To_v1alpha1_Output(&(*in)[i], &(*out)[i], s); err != nil {
+				return err
+			}
+		}
+	} else {
+		out.Outputs = nil
+	}
+	// WARNING: in.CreationTimestamp requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastSyncedHash requires manual conversion: does not exist in peer-type
+	// WARNING: in.LastSyncedCertificates requires manual conversion: does not exist in peer-type
 	return nil
 }
 
-// Convert_metadata_Metadata_To_v1alpha1_Metadata is an autogenerated conversion function.
-func Convert_metadata_Metadata_To_v1alpha1_Metadata(in *metadata.Metadata, out *Metadata, s conversion.Scope) error {
-	return autoConvert_metadata_Metadata_To_v1alpha1_Metadata(in, out, s)
-}
-
 func autoConvert_v1alpha1_Output_To_metadata_Output(in *Output, out *metadata.Output, s conversion.Scope) error {
 	out.Format = metadata.OutputFormat(in.Format)
 	out.UID = (*int64)(unsafe.Pointer(in.UID))
@@ -101,11 +122,8 @@ func autoConvert_metadata_Output_To_v1alpha1_Output(in *metadata.Output, out *Ou
 	out.Format = OutputFormat(in.Format)
 	out.UID = (*int64)(unsafe.Pointer(in.UID))
 	out.GID = (*int64)(unsafe.Pointer(in.GID))
+	// WARNING: in.Mode requires manual conversion: does not exist in peer-type
 	out.Path = in.Path
+	// WARNING: in.Filters requires manual conversion: does not exist in peer-type
 	return nil
 }
-
-// Convert_metadata_Output_To_v1alpha1_Output is an autogenerated conversion function.
-func Convert_metadata_Output_To_v1alpha1_Output(in *metadata.Output, out *Output, s conversion.Scope) error {
-	return autoConvert_metadata_Output_To_v1alpha1_Output(in, out, s)
-}
@@ -0,0 +1,22 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metadata contains the types used for storing volume metadata.
+
+// +kubebuilder:object:generate=true
+// +groupName=config.csi.trust-manager.io
+// +k8s:conversion-gen=github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata
+package v1alpha2
@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// Metadata contains the stored metadata for a given volume mount, it is
+// versioned to ensure an upgrade will always be able to load metadata
+type Metadata struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// VolumeID is the ID passed to the CSI driver in the NodePublish request.
+	VolumeID string `json:"volumeID"`
+	// PodNamespace is the namespace of the pod being mounted into
+	PodNamespace string `json:"podNamespace"`
+	// PodName is the name of the pod being mounted into
+	PodName string `json:"podName,omitempty"`
+	// PodUID is the UID of the pod being mounted into
+	PodUID string `json:"podUID,omitempty"`
+	// PodServiceAccount is the service account of the pod being mounted into
+	PodServiceAccount string `json:"podServiceAccount,omitempty"`
+	// Bundle is the trust bundle to mount
+	Bundle string `json:"bundle"`
+	// Outputs defines the output formats
+	Outputs []Output `json:"outputs"`
+	// CreationTimestamp is when the volume was published
+	CreationTimestamp metav1.Time `json:"creationTimestamp,omitempty"`
+	// LastSyncedHash is the hash of the bundle contents last written to the
+	// volume
+	LastSyncedHash string `json:"lastSyncedHash,omitempty"`
+	// LastSyncedCertificates is the number of certificates last written to
+	// the volume
+	LastSyncedCertificates int `json:"lastSyncedCertificates,omitempty"`
+}
+
+// Output defines an output for a given CSI trust bundle mount
+type Output struct {
+	// Format to write the certificate bundle
+	Format OutputFormat `json:"format"`
+
+	// Owner of the files
+	UID *int64 `json:"uid,omitempty"`
+	GID *int64 `json:"gid,omitempty"`
+
+	// Mode of the files, if unset the files are only readable by the owner
+	// and group
+	Mode *int32 `json:"mode,omitempty"`
+
+	// Path to the file or directory.
+	// For outputs that produce a single file this must be a path to the file,
+	// outputs that produce multiple files this will be the path to the
+	// directory
+	Path string `json:"path"`
+
+	// Filters select the certificates of the bundle written to the output,
+	// if unset every certificate is written
+	Filters *OutputFilters `json:"filters,omitempty"`
+}
+
+// OutputFilters select the certificates of the bundle written to an output
+type OutputFilters struct {
+	// ExcludeExpired leaves out the certificates that have expired
+	ExcludeExpired bool `json:"excludeExpired,omitempty"`
+}
+
+// OutputFormat defines the format to write the certificate bundle
+type OutputFormat string
+
+const (
+	// Output files in the OpenSSL rehash format, see
+	// https://manpages.ubuntu.com/manpages/noble/en/man1/c_rehash.1ssl.html
+	OutputFormatOpenSSLRehash = "OpenSSLRehash"
+	// Output a single concatenated file
+	OutputFormatConcatenatedFile = "ConcatenatedFile"
+)
@@ -35,6 +35,7 @@ func (in *Metadata) DeepCopyInto(out *Metadata) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	in.CreationTimestamp.DeepCopyInto(&out.CreationTimestamp)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Metadata.
@@ -68,6 +69,16 @@ func (in *Output) DeepCopyInto(out *Output) {
 		*out = new(int64)
 		**out = **in
 	}
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Filters != nil {
+		in, out := &in.Filters, &out.Filters
+		*out = new(OutputFilters)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Output.
@@ -79,3 +90,18 @@ func (in *Output) DeepCopy() *Output {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputFilters) DeepCopyInto(out *OutputFilters) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputFilters.
+func (in *OutputFilters) DeepCopy() *OutputFilters {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputFilters)
+	in.DeepCopyInto(out)
+	return out
+}
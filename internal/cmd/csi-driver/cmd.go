@@ -17,6 +17,7 @@ limitations under the License.
 package csidriver
 
 import (
+	"context"
 	"fmt"
 
 	trustv1alpha1 "github.com/cert-manager/trust-manager/pkg/apis/trust/v1alpha1"
@@ -34,6 +35,7 @@ import (
 	"github.com/cert-manager/trust-manager-csi-driver/internal/cmd/csi-driver/options"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 )
 
 const (
@@ -58,6 +60,16 @@ func NewCommand() *cobra.Command {
 			mlog := opts.Logr.WithName("controller-manager")
 			ctrl.SetLogger(mlog)
 
+			shutdownTracing, err := tracing.Setup(ctx, opts.Tracing)
+			if err != nil {
+				return fmt.Errorf("unable to setup tracing: %w", err)
+			}
+			defer func() {
+				if err := shutdownTracing(context.Background()); err != nil {
+					log.Error(err, "failed to flush traces")
+				}
+			}()
+
 			mustHaveBundleLabelKeyRequirement, err := labels.NewRequirement(trustv1alpha1.BundleLabelKey, selection.Exists, nil)
 			if err != nil {
 				return fmt.Errorf("invalid label selector: %w", err)
@@ -104,5 +116,9 @@ func NewCommand() *cobra.Command {
 
 	opts.AddFlags(cmd)
 
+	cmd.AddCommand(newValidatingWebhookCommand())
+	cmd.AddCommand(newMutatingWebhookCommand())
+	cmd.AddCommand(newVolumesCommand())
+
 	return cmd
 }
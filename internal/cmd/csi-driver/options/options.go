@@ -19,6 +19,7 @@ package options
 import (
 	"flag"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/spf13/cobra"
@@ -29,6 +30,7 @@ import (
 	"k8s.io/klog/v2/textlogger"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -63,6 +65,9 @@ type Options struct {
 
 	// CSI config
 	CSI config.Config
+
+	// Tracing config
+	Tracing tracing.Config
 }
 
 func New() *Options {
@@ -79,6 +84,23 @@ func (o *Options) Complete() error {
 		return fmt.Errorf("failed to build kubernetes rest config: %s", err)
 	}
 
+	if err := o.Tracing.Validate(); err != nil {
+		return err
+	}
+
+	switch o.CSI.StorageMode {
+	case config.StorageModeCopy, config.StorageModeShared:
+	default:
+		return fmt.Errorf("unknown storage mode %q, must be %q or %q", o.CSI.StorageMode, config.StorageModeCopy, config.StorageModeShared)
+	}
+
+	if o.CSI.SyncWorkers < 1 {
+		return fmt.Errorf("--sync-workers must be at least 1, got %d", o.CSI.SyncWorkers)
+	}
+	if o.CSI.MaxConcurrentReconciles < 1 {
+		return fmt.Errorf("--max-concurrent-reconciles must be at least 1, got %d", o.CSI.MaxConcurrentReconciles)
+	}
+
 	return nil
 }
 
@@ -86,9 +108,16 @@ func (o *Options) AddFlags(cmd *cobra.Command) {
 	var nfs cliflag.NamedFlagSets
 
 	o.addAppFlags(nfs.FlagSet("App"))
+	o.addTracingFlags(nfs.FlagSet("Tracing"))
 	o.kubeConfigFlags = genericclioptions.NewConfigFlags(true)
 	o.kubeConfigFlags.AddFlags(nfs.FlagSet("Kubernetes"))
 
+	addNamedFlagSets(cmd, nfs)
+}
+
+// addNamedFlagSets adds the flag sets to the command, printing each set as its
+// own section in the usage and help output.
+func addNamedFlagSets(cmd *cobra.Command, nfs cliflag.NamedFlagSets) {
 	usageFmt := "Usage:\n  %s\n"
 	cmd.SetUsageFunc(func(cmd *cobra.Command) error {
 		fmt.Fprintf(cmd.OutOrStderr(), usageFmt, cmd.UseLine())
@@ -128,16 +157,67 @@ func (o *Options) addAppFlags(fs *pflag.FlagSet) {
 
 	fs.StringVar(&o.CSI.DataDir, "data-root", ":6060",
 		"Directory the CSI driver uses to sync bundles into")
+
+	fs.StringVar(&o.CSI.PolicyFile, "policy-file", "",
+		"Path to a YAML file declaring which namespaces may mount which Bundles. If unset, every Bundle may be mounted.")
+
+	fs.DurationVar(&o.CSI.GCInterval, "gc-interval", 10*time.Minute,
+		"Interval between garbage collections of volumes that are no longer mounted. The value 0 disables garbage collection.")
+
+	fs.DurationVar(&o.CSI.StartupResyncTimeout, "startup-resync-timeout", 2*time.Minute,
+		"Maximum time to wait for the volumes of a previous instance to be resynced on start up before reporting ready.")
+
+	fs.DurationVar(&o.CSI.ResyncInterval, "resync-interval", 10*time.Minute,
+		"Interval between resyncs of every volume, correcting missed Bundle updates and files modified on disk. The value 0 disables periodic resyncs.")
+
+	fs.StringVar(&o.CSI.StorageMode, "storage-mode", config.StorageModeCopy,
+		`How files are stored in the tmpfs, either "copy" to write the files to every volume, or "shared" to store identical files once and hard link them into every volume.`)
+
+	fs.IntVar(&o.CSI.SyncWorkers, "sync-workers", 4,
+		"Number of volumes synced concurrently. The initial syncs of volumes being published are handed a worker before Bundle updates.")
+
+	fs.IntVar(&o.CSI.MaxConcurrentReconciles, "max-concurrent-reconciles", 2,
+		"Number of Bundles reconciled concurrently, the volumes of every Bundle share the sync workers.")
+
+	fs.BoolVar(&o.CSI.MigrateMetadata, "migrate-metadata", false,
+		"Rewrite the metadata of existing volumes in the current storage version on start up. Once rewritten, the metadata can not be read by older versions of the driver.")
+
+	fs.StringVar(&o.CSI.DebugAddress, "debug-bind-address", ":9403",
+		`TCP address for exposing the debug endpoint listing the volumes on the node, which will be served over HTTPS on the
+	 path '/debug/volumes'. The value "0" will disable the debug endpoint.`)
+
+	fs.BoolVar(&o.CSI.InsecureDebugEndpoint, "insecure-debug-endpoint", false,
+		"Serve the debug endpoint over HTTP without authentication. By default clients must present a bearer token allowed to get the '/debug/volumes' non-resource URL.")
+}
+
+func (o *Options) addTracingFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Tracing.Exporter, "tracing-exporter", tracing.ExporterNone,
+		`Exporter for OpenTelemetry traces, one of "none", "otlp" or "stdout".`)
+
+	fs.StringVar(&o.Tracing.OTLPEndpoint, "tracing-otlp-endpoint", "",
+		"host:port of the OTLP gRPC endpoint traces are exported to. If unset, the OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used.")
+
+	fs.BoolVar(&o.Tracing.OTLPInsecure, "tracing-otlp-insecure", false,
+		"Connect to the OTLP endpoint without TLS.")
+
+	fs.Float64Var(&o.Tracing.SampleRatio, "tracing-sample-ratio", 1,
+		"Ratio of traces to sample between 0 and 1. Traces with a sampled parent span are always sampled.")
 }
 
 func (o *Options) addLogFlags(fs *pflag.FlagSet) {
+	o.logConfig = addLogFlags(fs)
+}
+
+// addLogFlags adds the logging flags to the flag set, returning the config the
+// flags are bound to.
+func addLogFlags(fs *pflag.FlagSet) *textlogger.Config {
 	// Create a FlagSet, we create a new one so we can rewrite the flags
 	logFs := pflag.NewFlagSet("", pflag.ContinueOnError)
 	logGoFs := flag.NewFlagSet("", flag.ContinueOnError)
 
 	// Add the flags to the logFS flagset
-	o.logConfig = textlogger.NewConfig()
-	o.logConfig.AddFlags(logGoFs)
+	logConfig := textlogger.NewConfig()
+	logConfig.AddFlags(logGoFs)
 	logFs.AddGoFlagSet(logGoFs)
 
 	// Walk over the log flags, merging onto the real flagset
@@ -149,4 +229,6 @@ func (o *Options) addLogFlags(fs *pflag.FlagSet) {
 			fs.AddFlag(flag)
 		}
 	})
+
+	return logConfig
 }
@@ -0,0 +1,79 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	cliflag "k8s.io/component-base/cli/flag"
+)
+
+const (
+	// OutputTable prints the volumes as a table
+	OutputTable = "table"
+	// OutputJSON prints the volumes as returned by the debug endpoint
+	OutputJSON = "json"
+)
+
+// VolumesOptions are the options for the volumes subcommand. Populated via
+// processing command line flags.
+type VolumesOptions struct {
+	// Server is the URL of the debug endpoint server of the driver.
+	Server string
+
+	// InsecureSkipTLSVerify skips verifying the serving certificate of the
+	// server, the driver serves the debug endpoint with a self-signed
+	// certificate.
+	InsecureSkipTLSVerify bool
+
+	// TokenFile is the path to the bearer token sent to the debug endpoint.
+	TokenFile string
+
+	// Output is the output format, either table or json.
+	Output string
+}
+
+func (o *VolumesOptions) Complete() error {
+	switch o.Output {
+	case OutputTable, OutputJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, must be %q or %q", o.Output, OutputTable, OutputJSON)
+	}
+}
+
+func (o *VolumesOptions) AddFlags(cmd *cobra.Command) {
+	var nfs cliflag.NamedFlagSets
+	o.addAppFlags(nfs.FlagSet("App"))
+	addNamedFlagSets(cmd, nfs)
+}
+
+func (o *VolumesOptions) addAppFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.Server, "server", "https://localhost:9403",
+		"URL of the server of the driver serving the debug endpoint.")
+
+	fs.BoolVar(&o.InsecureSkipTLSVerify, "insecure-skip-tls-verify", true,
+		"Skip verifying the serving certificate of the server. The driver serves the debug endpoint with a self-signed certificate.")
+
+	fs.StringVar(&o.TokenFile, "token-file", "/var/run/secrets/kubernetes.io/serviceaccount/token",
+		"Path to the bearer token sent to the debug endpoint. No token is sent if the file does not exist.")
+
+	fs.StringVarP(&o.Output, "output", "o", OutputTable,
+		`Output format, either "table" or "json".`)
+}
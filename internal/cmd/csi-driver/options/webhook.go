@@ -0,0 +1,202 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package options
+
+import (
+	"fmt"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/rest"
+	cliflag "k8s.io/component-base/cli/flag"
+	"k8s.io/klog/v2/textlogger"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/webhook"
+)
+
+// WebhookOptions are the options for the admission webhook subcommands.
+// Populated via processing command line flags.
+type WebhookOptions struct {
+	// logConfig contains the logger config, including verbosity
+	logConfig *textlogger.Config
+
+	// kubeConfigFlags is used for generating a Kubernetes rest config via CLI
+	// flags.
+	kubeConfigFlags *genericclioptions.ConfigFlags
+
+	// MetricsAddress is the TCP address for exposing HTTP Prometheus metrics
+	// which will be served on the HTTP path '/metrics'. The value "0" will
+	// disable exposing metrics.
+	MetricsAddress string
+
+	// ReadyzAddress is the TCP address for exposing the HTTP readiness probe
+	// which will be served on the HTTP path '/readyz'.
+	ReadyzAddress string
+
+	// WebhookPort is the TCP port the webhook server listens on.
+	WebhookPort int
+
+	// WebhookCertDir is the directory containing the serving certificate and
+	// private key of the webhook server, named tls.crt and tls.key.
+	WebhookCertDir string
+
+	// DriverName is the name of the CSI driver, only volumes using this driver
+	// are handled by the webhook.
+	DriverName string
+
+	// RestConfig is the shared base rest config to connect to the Kubernetes
+	// API.
+	RestConfig *rest.Config
+
+	// Logr is the shared base logger.
+	Logr logr.Logger
+}
+
+func (o *WebhookOptions) Complete() error {
+	o.Logr = textlogger.NewLogger(o.logConfig)
+
+	var err error
+	o.RestConfig, err = o.kubeConfigFlags.ToRESTConfig()
+	if err != nil {
+		return fmt.Errorf("failed to build kubernetes rest config: %s", err)
+	}
+
+	return nil
+}
+
+func (o *WebhookOptions) AddFlags(cmd *cobra.Command) {
+	var nfs cliflag.NamedFlagSets
+	o.addFlagSets(&nfs)
+	addNamedFlagSets(cmd, nfs)
+}
+
+func (o *WebhookOptions) addFlagSets(nfs *cliflag.NamedFlagSets) {
+	o.addAppFlags(nfs.FlagSet("App"))
+	o.addWebhookFlags(nfs.FlagSet("Webhook"))
+	o.kubeConfigFlags = genericclioptions.NewConfigFlags(true)
+	o.kubeConfigFlags.AddFlags(nfs.FlagSet("Kubernetes"))
+}
+
+func (o *WebhookOptions) addAppFlags(fs *pflag.FlagSet) {
+	o.logConfig = addLogFlags(fs)
+
+	fs.StringVar(&o.MetricsAddress, "metrics-bind-address", ":9402",
+		`TCP address for exposing HTTP Prometheus metrics which will be served on the HTTP path '/metrics'. The value "0" will
+	 disable exposing metrics.`)
+
+	fs.StringVar(&o.ReadyzAddress, "readiness-probe-bind-address", ":6060",
+		"TCP address for exposing the HTTP readiness probe which will be served on the HTTP path '/readyz'.")
+
+	fs.StringVar(&o.DriverName, "driver-name", "trust-manager-csi-driver",
+		"Name of the CSI driver whose volumes are handled by the webhook.")
+}
+
+func (o *WebhookOptions) addWebhookFlags(fs *pflag.FlagSet) {
+	fs.IntVar(&o.WebhookPort, "webhook-port", 10250,
+		"TCP port the webhook server listens on.")
+
+	fs.StringVar(&o.WebhookCertDir, "webhook-cert-dir", "/tls",
+		"Directory containing the serving certificate and private key of the webhook server, named tls.crt and tls.key.")
+}
+
+// ValidatingWebhookOptions are the options for the validating-webhook
+// subcommand.
+type ValidatingWebhookOptions struct {
+	WebhookOptions
+
+	// PolicyFile is the path to the policy declaring which namespaces may
+	// mount which Bundles, the same policy as given to the CSI driver.
+	PolicyFile string
+
+	// Policy is the policy loaded from PolicyFile.
+	Policy *policy.Policy
+}
+
+func (o *ValidatingWebhookOptions) Complete() error {
+	if err := o.WebhookOptions.Complete(); err != nil {
+		return err
+	}
+
+	var err error
+	o.Policy, err = policy.Load(o.PolicyFile)
+	return err
+}
+
+func (o *ValidatingWebhookOptions) AddFlags(cmd *cobra.Command) {
+	var nfs cliflag.NamedFlagSets
+	o.addFlagSets(&nfs)
+	o.addPolicyFlags(nfs.FlagSet("Policy"))
+	addNamedFlagSets(cmd, nfs)
+}
+
+func (o *ValidatingWebhookOptions) addPolicyFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.PolicyFile, "policy-file", "",
+		"Path to a YAML file declaring which namespaces may mount which Bundles. If unset, every Bundle may be mounted.")
+}
+
+// MutatingWebhookOptions are the options for the mutating-webhook subcommand.
+type MutatingWebhookOptions struct {
+	WebhookOptions
+
+	// InjectProfilesFile is the path to a YAML file with additional injection
+	// profiles.
+	InjectProfilesFile string
+
+	// DefaultInjectProfile is the injection profile used for Pods that don't
+	// name a profile.
+	DefaultInjectProfile string
+
+	// InjectProfiles are the built-in profiles merged with the profiles loaded
+	// from InjectProfilesFile.
+	InjectProfiles map[string]webhook.InjectProfile
+}
+
+func (o *MutatingWebhookOptions) Complete() error {
+	if err := o.WebhookOptions.Complete(); err != nil {
+		return err
+	}
+
+	var err error
+	o.InjectProfiles, err = webhook.LoadInjectProfiles(o.InjectProfilesFile)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := o.InjectProfiles[o.DefaultInjectProfile]; !ok {
+		return fmt.Errorf("default injection profile %q does not exist", o.DefaultInjectProfile)
+	}
+
+	return nil
+}
+
+func (o *MutatingWebhookOptions) AddFlags(cmd *cobra.Command) {
+	var nfs cliflag.NamedFlagSets
+	o.addFlagSets(&nfs)
+	o.addInjectFlags(nfs.FlagSet("Injection"))
+	addNamedFlagSets(cmd, nfs)
+}
+
+func (o *MutatingWebhookOptions) addInjectFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&o.InjectProfilesFile, "inject-profiles-file", "",
+		"Path to a YAML file with injection profiles, in addition to the built-in debian, alpine and rhel profiles.")
+
+	fs.StringVar(&o.DefaultInjectProfile, "default-inject-profile", "debian",
+		"Injection profile used for Pods that don't set the trust.cert-manager.io/inject-profile annotation.")
+}
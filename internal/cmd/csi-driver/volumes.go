@@ -0,0 +1,101 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csidriver
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/cmd/csi-driver/options"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/debug"
+)
+
+// newVolumesCommand returns the subcommand listing the volumes tracked by a
+// running driver, using its debug endpoint.
+func newVolumesCommand() *cobra.Command {
+	opts := new(options.VolumesOptions)
+
+	cmd := &cobra.Command{
+		Use:   "volumes",
+		Short: "List the volumes tracked by the CSI driver on a node.",
+		Long: `List the volumes tracked by the CSI driver on a node, along with the result of
+their last sync. The volumes are fetched from the debug endpoint of a running
+driver, by default the one in the same Pod:
+
+  kubectl exec -n <namespace> <driver-pod> -c trust-manager-csi-driver -- /ko-app/csi-driver volumes`,
+		Args: cobra.NoArgs,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Complete()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			token, err := os.ReadFile(opts.TokenFile)
+			if err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("could not read token: %w", err)
+			}
+
+			httpClient := &http.Client{
+				Timeout: 30 * time.Second,
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: opts.InsecureSkipTLSVerify}, //nolint:gosec // the debug endpoint uses a self-signed certificate
+				},
+			}
+			list, err := debug.List(cmd.Context(), httpClient, opts.Server, strings.TrimSpace(string(token)))
+			if err != nil {
+				return fmt.Errorf("could not list volumes: %w", err)
+			}
+
+			if opts.Output == options.OutputJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(list)
+			}
+
+			return printVolumes(cmd, list)
+		},
+	}
+
+	opts.AddFlags(cmd)
+
+	return cmd
+}
+
+func printVolumes(cmd *cobra.Command, list debug.VolumeList) error {
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "VOLUME ID\tNAMESPACE\tPOD\tBUNDLE\tCERTIFICATES\tLAST SUCCESS\tHASH\tERROR")
+	for _, volume := range list.Volumes {
+		lastSuccess := "<never>"
+		if !volume.Status.LastSuccess.IsZero() {
+			lastSuccess = volume.Status.LastSuccess.Format(time.RFC3339)
+		}
+		hash := volume.Status.Hash
+		if len(hash) > 12 {
+			hash = hash[:12]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			volume.VolumeID, volume.PodNamespace, volume.PodName, volume.Bundle,
+			volume.Status.Certificates, lastSuccess, hash, volume.Status.LastError)
+	}
+	return w.Flush()
+}
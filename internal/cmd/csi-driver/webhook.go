@@ -0,0 +1,137 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csidriver
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	ctrlwebhook "sigs.k8s.io/controller-runtime/pkg/webhook"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/cmd/csi-driver/options"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/webhook"
+)
+
+// newValidatingWebhookCommand returns the subcommand running the validating
+// admission webhook for Pods using the CSI driver.
+func newValidatingWebhookCommand() *cobra.Command {
+	opts := new(options.ValidatingWebhookOptions)
+
+	cmd := &cobra.Command{
+		Use:   "validating-webhook",
+		Short: "Validating admission webhook for Pods using the CSI driver.",
+		Long: `Validating admission webhook for Pods using the CSI driver. The inline CSI
+volumes of each Pod are validated when the Pod is created, so mistakes are
+reported straight away instead of leaving the Pod stuck in ContainerCreating.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Complete()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			log.Log = opts.Logr.WithName("apiutil")
+			log := opts.Logr.WithName("main")
+			mlog := opts.Logr.WithName("controller-manager")
+			ctrl.SetLogger(mlog)
+
+			mgr, err := newWebhookManager(&opts.WebhookOptions)
+			if err != nil {
+				return err
+			}
+
+			webhook.SetupValidating(mgr, opts.DriverName, opts.Policy)
+
+			log.Info("starting validating webhook...")
+			return mgr.Start(ctx)
+		},
+	}
+
+	opts.AddFlags(cmd)
+
+	return cmd
+}
+
+// newMutatingWebhookCommand returns the subcommand running the mutating
+// admission webhook, which injects trust bundle volumes into annotated Pods.
+func newMutatingWebhookCommand() *cobra.Command {
+	opts := new(options.MutatingWebhookOptions)
+
+	cmd := &cobra.Command{
+		Use:   "mutating-webhook",
+		Short: "Mutating admission webhook injecting trust bundles into Pods.",
+		Long: `Mutating admission webhook injecting trust bundles into Pods. Pods annotated
+with trust.cert-manager.io/inject: <bundle> get a CSI volume for the bundle,
+mounted into every container at the CA certificate paths of the injection
+profile chosen with the trust.cert-manager.io/inject-profile annotation.`,
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return opts.Complete()
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			log.Log = opts.Logr.WithName("apiutil")
+			log := opts.Logr.WithName("main")
+			mlog := opts.Logr.WithName("controller-manager")
+			ctrl.SetLogger(mlog)
+
+			mgr, err := newWebhookManager(&opts.WebhookOptions)
+			if err != nil {
+				return err
+			}
+
+			webhook.SetupMutating(mgr, opts.DriverName, opts.InjectProfiles, opts.DefaultInjectProfile)
+
+			log.Info("starting mutating webhook...")
+			return mgr.Start(ctx)
+		},
+	}
+
+	opts.AddFlags(cmd)
+
+	return cmd
+}
+
+// newWebhookManager creates the controller manager shared by the webhook
+// subcommands.
+func newWebhookManager(opts *options.WebhookOptions) (ctrl.Manager, error) {
+	mgr, err := ctrl.NewManager(opts.RestConfig, ctrl.Options{
+		Scheme: scheme.New(),
+		WebhookServer: ctrlwebhook.NewServer(ctrlwebhook.Options{
+			Port:    opts.WebhookPort,
+			CertDir: opts.WebhookCertDir,
+		}),
+		ReadinessEndpointName:  "/readyz",
+		HealthProbeBindAddress: opts.ReadyzAddress,
+		Metrics: server.Options{
+			BindAddress: opts.MetricsAddress,
+		},
+		Logger: opts.Logr.WithName("controller-manager"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create controller manager: %w", err)
+	}
+
+	if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		return nil, fmt.Errorf("unable to add readyz check: %w", err)
+	}
+
+	return mgr, nil
+}
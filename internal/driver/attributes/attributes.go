@@ -0,0 +1,197 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package attributes contains the parsing of the volume attributes set on a
+// CSI volume, i.e. the pod.spec.volumes[].csi.volumeAttributes field.
+package attributes
+
+import (
+	"encoding/csv"
+	"fmt"
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+const (
+	// Prefix is the prefix of all volume attributes owned by the driver
+	Prefix = "trust.cert-manager.io/"
+
+	// BundleKey is the name of the trust-manager Bundle to mount
+	BundleKey = Prefix + "bundle"
+	// OutputsKey is a JSON or YAML list of outputs, see Output
+	OutputsKey = Prefix + "outputs"
+	// ConcatenatedFilesKey is a comma separated list of paths to write the
+	// bundle to as a single concatenated file
+	ConcatenatedFilesKey = Prefix + "concatenated-files"
+	// OpenSSLRehashKey is a comma separated list of directories to write the
+	// bundle to in the OpenSSL rehash format
+	OpenSSLRehashKey = Prefix + "openssl-rehash"
+)
+
+// Output is the user facing representation of a single output, a list of these
+// is set in the trust.cert-manager.io/outputs volume attribute. For example:
+//
+//	trust.cert-manager.io/outputs: |
+//	  - format: ConcatenatedFile
+//	    path: ca-certificates.crt
+//	  - format: OpenSSLRehash
+//	    path: /
+type Output struct {
+	// Format to write the certificate bundle
+	Format metadata.OutputFormat `json:"format"`
+	// Path to the file or directory relative to the root of the volume
+	Path string `json:"path"`
+	// Owner of the files, if the GID is unset the volume mount group passed
+	// by the kubelet is used.
+	UID *int64 `json:"uid,omitempty"`
+	GID *int64 `json:"gid,omitempty"`
+	// Mode of the files, for example 0444 to make the files world readable.
+	// Defaults to 0440.
+	Mode *int32 `json:"mode,omitempty"`
+}
+
+// Attributes are the parsed and validated volume attributes of a volume
+type Attributes struct {
+	// Bundle is the trust bundle to mount
+	Bundle string
+	// Outputs defines the output formats
+	Outputs []metadata.Output
+}
+
+// Parse parses and validates the trust.cert-manager.io/* volume attributes.
+// Every problem found is returned in a single aggregated error, so all of them
+// can be fixed at once.
+//
+// The structured trust.cert-manager.io/outputs attribute and the legacy comma
+// separated attributes can be used together, the legacy attributes are
+// translated into the same structure.
+func Parse(volumeContext map[string]string) (Attributes, error) {
+	attrs, errs := ParseAt(field.NewPath("volumeAttributes"), volumeContext)
+	if len(errs) > 0 {
+		return Attributes{}, errs.ToAggregate()
+	}
+
+	return attrs, nil
+}
+
+// ParseAt is the same as Parse, but returns the errors as a list with each
+// error relative to the given field path. This allows the errors to point to
+// the exact field when validating a Pod spec.
+func ParseAt(fldPath *field.Path, volumeContext map[string]string) (Attributes, field.ErrorList) {
+	errs := validateKeys(fldPath, volumeContext)
+
+	bundle := volumeContext[BundleKey]
+	errs = append(errs, validateBundle(fldPath.Key(BundleKey), bundle)...)
+
+	outputs, outputErrs := parseOutputs(fldPath, volumeContext)
+	errs = append(errs, outputErrs...)
+	errs = append(errs, validateOutputs(outputs)...)
+
+	if len(outputs) == 0 && len(outputErrs) == 0 {
+		errs = append(errs, field.Required(fldPath.Key(OutputsKey), "at least one output must be specified"))
+	}
+
+	if len(errs) > 0 {
+		return Attributes{}, errs
+	}
+
+	attrs := Attributes{Bundle: bundle}
+	for _, output := range outputs {
+		attrs.Outputs = append(attrs.Outputs, metadata.Output{
+			Format: output.Format,
+			UID:    output.UID,
+			GID:    output.GID,
+			Mode:   output.Mode,
+			Path:   output.Path,
+		})
+	}
+
+	return attrs, nil
+}
+
+// parsedOutput is an output along with the field it was parsed from, this is
+// used to point at the offending attribute in error messages.
+type parsedOutput struct {
+	Output
+	fldPath *field.Path
+}
+
+func parseOutputs(fldPath *field.Path, volumeContext map[string]string) ([]parsedOutput, field.ErrorList) {
+	var errs field.ErrorList
+	var outputs []parsedOutput
+
+	if raw := volumeContext[OutputsKey]; strings.TrimSpace(raw) != "" {
+		var structured []Output
+
+		// YAML is a superset of JSON, so this handles both
+		if err := yaml.UnmarshalStrict([]byte(raw), &structured); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(OutputsKey), raw, fmt.Sprintf("could not parse outputs: %s", err)))
+		}
+
+		for i, output := range structured {
+			outputs = append(outputs, parsedOutput{Output: output, fldPath: fldPath.Key(OutputsKey).Index(i)})
+		}
+	}
+
+	// The legacy attributes only support setting the path
+	legacy := []struct {
+		key    string
+		format metadata.OutputFormat
+	}{
+		{key: ConcatenatedFilesKey, format: metadata.OutputFormatConcatenatedFile},
+		{key: OpenSSLRehashKey, format: metadata.OutputFormatOpenSSLRehash},
+	}
+
+	for _, l := range legacy {
+		paths, err := splitList(volumeContext[l.key])
+		if err != nil {
+			errs = append(errs, field.Invalid(fldPath.Key(l.key), volumeContext[l.key], fmt.Sprintf("could not parse comma separated list: %s", err)))
+			continue
+		}
+
+		for i, p := range paths {
+			outputs = append(outputs, parsedOutput{
+				Output:  Output{Format: l.format, Path: p},
+				fldPath: fldPath.Key(l.key).Index(i),
+			})
+		}
+	}
+
+	// We use path.Join to clean any leading "../" to prevent path traversal
+	// attacks
+	for i := range outputs {
+		outputs[i].Path = path.Join("/", outputs[i].Path)
+	}
+
+	return outputs, errs
+}
+
+// splitList splits a comma separated list, an empty string results in an empty
+// list.
+func splitList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	cr := csv.NewReader(strings.NewReader(s))
+	cr.TrimLeadingSpace = true
+	return cr.Read()
+}
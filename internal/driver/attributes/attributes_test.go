@@ -0,0 +1,256 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attributes_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/utils/ptr"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		Name          string
+		VolumeContext map[string]string
+		Expected      []metadata.Output
+		ExpectErr     bool
+	}{
+		{
+			Name: "legacy_attributes",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:            "example.com",
+				attributes.ConcatenatedFilesKey: "ca-certificates.crt, other.crt",
+				attributes.OpenSSLRehashKey:     "/",
+			},
+			Expected: []metadata.Output{
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca-certificates.crt"},
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/other.crt"},
+				{Format: metadata.OutputFormatOpenSSLRehash, Path: "/"},
+			},
+		},
+		{
+			Name: "only_one_legacy_attribute",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:        "example.com",
+				attributes.OpenSSLRehashKey: "certs",
+			},
+			Expected: []metadata.Output{
+				{Format: metadata.OutputFormatOpenSSLRehash, Path: "/certs"},
+			},
+		},
+		{
+			Name: "json_outputs",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "example.com",
+				attributes.OutputsKey: `[{"format": "ConcatenatedFile", "path": "ca.crt", "uid": 1000, "gid": 2000}]`,
+			},
+			Expected: []metadata.Output{
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt", UID: ptr.To[int64](1000), GID: ptr.To[int64](2000)},
+			},
+		},
+		{
+			Name: "yaml_outputs_with_legacy_attributes",
+			VolumeContext: map[string]string{
+				attributes.BundleKey: "example.com",
+				attributes.OutputsKey: `
+- format: OpenSSLRehash
+  path: ../../certs
+`,
+				attributes.ConcatenatedFilesKey: "ca.crt",
+			},
+			Expected: []metadata.Output{
+				{Format: metadata.OutputFormatOpenSSLRehash, Path: "/certs"},
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"},
+			},
+		},
+		{
+			Name: "yaml_octal_mode",
+			VolumeContext: map[string]string{
+				attributes.BundleKey: "example.com",
+				attributes.OutputsKey: `
+- format: ConcatenatedFile
+  path: ca.crt
+  mode: 0444
+`,
+			},
+			Expected: []metadata.Output{
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt", Mode: ptr.To[int32](0444)},
+			},
+		},
+		{
+			Name: "invalid_mode",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "example.com",
+				attributes.OutputsKey: `[{"format": "ConcatenatedFile", "path": "ca.crt", "mode": 2048}]`,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "invalid_uid",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "example.com",
+				attributes.OutputsKey: `[{"format": "ConcatenatedFile", "path": "ca.crt", "uid": -1}]`,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "unknown_field",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "example.com",
+				attributes.OutputsKey: `[{"format": "ConcatenatedFile", "path": "ca.crt", "owner": 1000}]`,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "unknown_format",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "example.com",
+				attributes.OutputsKey: `[{"format": "PKCS12", "path": "ca.p12"}]`,
+			},
+			ExpectErr: true,
+		},
+		{
+			Name: "no_outputs",
+			VolumeContext: map[string]string{
+				attributes.BundleKey: "example.com",
+			},
+			ExpectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			attrs, err := attributes.Parse(test.VolumeContext)
+			if test.ExpectErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if !reflect.DeepEqual(attrs.Outputs, test.Expected) {
+				t.Fatalf("unexpected outputs: wanted %+v, got %+v", test.Expected, attrs.Outputs)
+			}
+		})
+	}
+}
+
+func TestParseValidation(t *testing.T) {
+	tests := []struct {
+		Name          string
+		VolumeContext map[string]string
+		ExpectErrs    []string
+	}{
+		{
+			Name: "valid_file_next_to_rehash_files",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:            "example.com",
+				attributes.OpenSSLRehashKey:     "/",
+				attributes.ConcatenatedFilesKey: "ca-certificates.crt",
+			},
+		},
+		{
+			Name: "missing_bundle",
+			VolumeContext: map[string]string{
+				attributes.OpenSSLRehashKey: "/",
+			},
+			ExpectErrs: []string{
+				"volumeAttributes[trust.cert-manager.io/bundle]: Required value",
+			},
+		},
+		{
+			Name: "unknown_attribute",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:                     "example.com",
+				"trust.cert-manager.io/openssl-rehashes": "/",
+				"csi.storage.k8s.io/pod.name":            "example",
+			},
+			ExpectErrs: []string{
+				"volumeAttributes[trust.cert-manager.io/openssl-rehashes]: Forbidden: unknown attribute",
+				"volumeAttributes[trust.cert-manager.io/outputs]: Required value",
+			},
+		},
+		{
+			Name: "duplicate_paths",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:            "example.com",
+				attributes.OutputsKey:           `[{"format": "ConcatenatedFile", "path": "/ca.crt"}]`,
+				attributes.ConcatenatedFilesKey: "ca.crt",
+			},
+			ExpectErrs: []string{
+				"volumeAttributes[trust.cert-manager.io/concatenated-files][0].path: Invalid value: \"/ca.crt\": path is already used by volumeAttributes[trust.cert-manager.io/outputs][0]",
+			},
+		},
+		{
+			Name: "file_and_rehash_directory_collide",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:            "example.com",
+				attributes.OpenSSLRehashKey:     "certs",
+				attributes.ConcatenatedFilesKey: "certs, certs/0a775a30.0",
+			},
+			ExpectErrs: []string{
+				"volumeAttributes[trust.cert-manager.io/openssl-rehash][0].path: Invalid value: \"/certs\": path is already used by volumeAttributes[trust.cert-manager.io/concatenated-files][0]",
+				"volumeAttributes[trust.cert-manager.io/concatenated-files][1].path: Invalid value: \"/certs/0a775a30.0\": path overlaps with the file written by volumeAttributes[trust.cert-manager.io/concatenated-files][0]",
+				"volumeAttributes[trust.cert-manager.io/concatenated-files][1].path: Invalid value: \"/certs/0a775a30.0\": path collides with the OpenSSL rehash files written by volumeAttributes[trust.cert-manager.io/openssl-rehash][0]",
+			},
+		},
+		{
+			Name: "all_errors_reported",
+			VolumeContext: map[string]string{
+				attributes.BundleKey:  "Not_A_Bundle",
+				attributes.OutputsKey: `[{"format": "PKCS12", "path": "/"}, {"format": "ConcatenatedFile", "path": "/", "mode": 4095}]`,
+			},
+			ExpectErrs: []string{
+				"volumeAttributes[trust.cert-manager.io/bundle]: Invalid value: \"Not_A_Bundle\"",
+				"volumeAttributes[trust.cert-manager.io/outputs][0].format: Unsupported value: \"PKCS12\"",
+				"volumeAttributes[trust.cert-manager.io/outputs][1].path: Invalid value: \"/\": must be a file, not the root of the volume",
+				"volumeAttributes[trust.cert-manager.io/outputs][1].mode: Invalid value: \"7777\": must be between 0000 and 0777",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := attributes.Parse(test.VolumeContext)
+			if len(test.ExpectErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+
+			for _, expected := range test.ExpectErrs {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got %q", expected, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package attributes
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+// knownKeys are all the trust.cert-manager.io/* volume attributes understood by
+// the driver
+var knownKeys = sets.New(BundleKey, OutputsKey, ConcatenatedFilesKey, OpenSSLRehashKey)
+
+// supportedFormats are all the output formats understood by the driver
+var supportedFormats = []metadata.OutputFormat{metadata.OutputFormatConcatenatedFile, metadata.OutputFormatOpenSSLRehash}
+
+// rehashFileName matches the names of files written by the OpenSSLRehash
+// format, "<hash>.<count>"
+var rehashFileName = regexp.MustCompile(`^[0-9a-f]{8}\.[0-9]+$`)
+
+// validateKeys rejects unknown trust.cert-manager.io/* attributes, these are
+// most likely typos that would otherwise be silently ignored.
+func validateKeys(fldPath *field.Path, volumeContext map[string]string) field.ErrorList {
+	var errs field.ErrorList
+
+	// Keys are sorted so the error message is stable
+	for _, key := range sets.List(sets.KeySet(volumeContext)) {
+		if strings.HasPrefix(key, Prefix) && !knownKeys.Has(key) {
+			errs = append(errs, field.Forbidden(fldPath.Key(key), fmt.Sprintf("unknown attribute, supported attributes are: %s", strings.Join(sets.List(knownKeys), ", "))))
+		}
+	}
+
+	return errs
+}
+
+func validateBundle(fldPath *field.Path, bundle string) field.ErrorList {
+	if bundle == "" {
+		return field.ErrorList{field.Required(fldPath, "the name of the trust-manager Bundle to mount must be set")}
+	}
+
+	var errs field.ErrorList
+	for _, msg := range validation.IsDNS1123Subdomain(bundle) {
+		errs = append(errs, field.Invalid(fldPath, bundle, msg))
+	}
+
+	return errs
+}
+
+func validateOutputs(outputs []parsedOutput) field.ErrorList {
+	var errs field.ErrorList
+
+	for _, output := range outputs {
+		errs = append(errs, validateOutput(output)...)
+	}
+
+	// Compare every pair of outputs, the number of outputs is always small so
+	// there is no need to be clever here.
+	for i, a := range outputs {
+		for _, b := range outputs[i+1:] {
+			if err := overlap(a, b); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateOutput(output parsedOutput) field.ErrorList {
+	var errs field.ErrorList
+
+	switch output.Format {
+	case metadata.OutputFormatConcatenatedFile:
+		if output.Path == "/" {
+			errs = append(errs, field.Invalid(output.fldPath.Child("path"), output.Path, "must be a file, not the root of the volume"))
+		}
+	case metadata.OutputFormatOpenSSLRehash:
+	default:
+		errs = append(errs, field.NotSupported(output.fldPath.Child("format"), output.Format, supportedFormats))
+	}
+
+	if output.UID != nil {
+		for _, msg := range validation.IsValidUserID(*output.UID) {
+			errs = append(errs, field.Invalid(output.fldPath.Child("uid"), *output.UID, msg))
+		}
+	}
+
+	if output.GID != nil {
+		for _, msg := range validation.IsValidGroupID(*output.GID) {
+			errs = append(errs, field.Invalid(output.fldPath.Child("gid"), *output.GID, msg))
+		}
+	}
+
+	// Only the permission bits can be set, setuid/setgid/sticky bits make no
+	// sense for certificate files.
+	if output.Mode != nil && (*output.Mode < 0 || *output.Mode > 0777) {
+		errs = append(errs, field.Invalid(output.fldPath.Child("mode"), fmt.Sprintf("%04o", *output.Mode), "must be between 0000 and 0777"))
+	}
+
+	return errs
+}
+
+// overlap checks if two outputs would write to the same files, returning an
+// error describing the problem if they do.
+func overlap(a, b parsedOutput) *field.Error {
+	if a.Path == b.Path {
+		return field.Invalid(b.fldPath.Child("path"), b.Path, fmt.Sprintf("path is already used by %s", a.fldPath))
+	}
+
+	// Order the outputs so that a is always the one closer to the root, this
+	// halves the number of cases below.
+	if isWithin(b.Path, a.Path) {
+		a, b = b, a
+	}
+
+	if !isWithin(a.Path, b.Path) {
+		return nil
+	}
+
+	switch a.Format {
+	case metadata.OutputFormatConcatenatedFile:
+		// A file cannot also be a directory
+		return field.Invalid(b.fldPath.Child("path"), b.Path, fmt.Sprintf("path overlaps with the file written by %s", a.fldPath))
+	case metadata.OutputFormatOpenSSLRehash:
+		// Files can live next to the rehash files (e.g. ca-certificates.crt in
+		// /etc/ssl/certs), as long as they do not use a rehash file name.
+		if path.Dir(b.Path) == a.Path && rehashFileName.MatchString(path.Base(b.Path)) {
+			return field.Invalid(b.fldPath.Child("path"), b.Path, fmt.Sprintf("path collides with the OpenSSL rehash files written by %s", a.fldPath))
+		}
+	}
+
+	return nil
+}
+
+// isWithin returns true if p is a descendant of the directory dir
+func isWithin(dir, p string) bool {
+	if dir == "/" {
+		return p != "/"
+	}
+
+	return strings.HasPrefix(p, dir+"/")
+}
@@ -19,11 +19,16 @@ package bundlewriter
 import (
 	"context"
 	"fmt"
+	"sync"
 
 	trustv1alpha1 "github.com/cert-manager/trust-manager/pkg/apis/trust/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 )
 
 // BundleLoader is used to load the CA bundle
@@ -37,11 +42,64 @@ func NewBundleLoader(client client.Client) BundleLoader {
 	return bundleLoader{client: client}
 }
 
+// NewMemoizedLoader returns a BundleLoader that loads each bundle in a
+// namespace at most once, so the volumes synced by a single reconcile share
+// the load. Bundles are never reloaded, so the loader must not be reused
+// across reconciles.
+func NewMemoizedLoader(loader BundleLoader) BundleLoader {
+	return &memoizedLoader{loader: loader, loaded: make(map[memoizedLoaderKey]*memoizedLoad)}
+}
+
+type memoizedLoaderKey struct {
+	namespace string
+	name      string
+}
+
+// memoizedLoad is the load of a single bundle, concurrent loads of the same
+// bundle wait for the first one.
+type memoizedLoad struct {
+	once   sync.Once
+	bundle []byte
+	err    error
+}
+
+type memoizedLoader struct {
+	loader BundleLoader
+
+	// mu only guards the map, bundles in different namespaces are loaded
+	// concurrently
+	mu     sync.Mutex
+	loaded map[memoizedLoaderKey]*memoizedLoad
+}
+
+func (l *memoizedLoader) Load(ctx context.Context, namespace, name string) ([]byte, error) {
+	key := memoizedLoaderKey{namespace: namespace, name: name}
+
+	l.mu.Lock()
+	load, ok := l.loaded[key]
+	if !ok {
+		load = &memoizedLoad{}
+		l.loaded[key] = load
+	}
+	l.mu.Unlock()
+
+	load.once.Do(func() {
+		load.bundle, load.err = l.loader.Load(ctx, namespace, name)
+	})
+	return load.bundle, load.err
+}
+
 type bundleLoader struct {
 	client client.Client
 }
 
-func (l bundleLoader) Load(ctx context.Context, namespace, name string) ([]byte, error) {
+func (l bundleLoader) Load(ctx context.Context, namespace, name string) (_ []byte, err error) {
+	ctx, span := tracing.Start(ctx, "BundleLoader.Load", trace.WithAttributes(
+		attribute.String("bundle", name),
+		attribute.String("namespace", namespace),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	// Load the bundle object
 	var bundle trustv1alpha1.Bundle
 	if err := l.client.Get(ctx, client.ObjectKey{Name: name}, &bundle); err != nil {
@@ -0,0 +1,89 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundlewriter_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+)
+
+// blockingLoader blocks loads of the namespace "blocked" until release is
+// closed, and counts the loads of each namespace.
+type blockingLoader struct {
+	started chan struct{}
+	release chan struct{}
+	loads   sync.Map
+}
+
+func (l *blockingLoader) Load(_ context.Context, namespace, name string) ([]byte, error) {
+	count, _ := l.loads.LoadOrStore(namespace, new(atomic.Int32))
+	count.(*atomic.Int32).Add(1)
+
+	if namespace == "blocked" {
+		l.started <- struct{}{}
+		<-l.release
+	}
+	return []byte(namespace + "/" + name), nil
+}
+
+func TestMemoizedLoader(t *testing.T) {
+	inner := &blockingLoader{started: make(chan struct{}, 3), release: make(chan struct{})}
+	loader := bundlewriter.NewMemoizedLoader(inner)
+
+	// Concurrent loads of the same bundle share a single load
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Go(func() {
+			bundle, err := loader.Load(t.Context(), "blocked", "bundle")
+			if err != nil || string(bundle) != "blocked/bundle" {
+				t.Errorf("unexpected load: %q, %v", bundle, err)
+			}
+		})
+	}
+
+	// A bundle in another namespace is loaded while the first load is blocked
+	<-inner.started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if bundle, err := loader.Load(t.Context(), "other", "bundle"); err != nil || string(bundle) != "other/bundle" {
+			t.Errorf("unexpected load: %q, %v", bundle, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the load of another namespace not to wait for a blocked load")
+	}
+
+	close(inner.release)
+	wg.Wait()
+
+	// Later loads are served from memory
+	if _, err := loader.Load(t.Context(), "blocked", "bundle"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := inner.loads.Load("blocked"); count.(*atomic.Int32).Load() != 1 {
+		t.Errorf("expected the bundle to be loaded once, got %d loads", count.(*atomic.Int32).Load())
+	}
+}
@@ -19,62 +19,178 @@ package bundlewriter
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"fmt"
+	"maps"
 	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/util/sets"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 	x509util "github.com/cert-manager/trust-manager-csi-driver/internal/utils/x509"
 	volumeutil "github.com/cert-manager/trust-manager-csi-driver/third_party/k8s.io/kubernetes/pkg/volume/util"
 )
 
+// DefaultFileMode is the mode of written files when an output does not
+// specify one
+const DefaultFileMode int32 = 0440
+
 // BundleWriter is used to write a bundle to a directory
 type BundleWriter struct {
 	FileWriter   FileWriter
 	BundleLoader BundleLoader
+
+	// renders caches the rendered bundles, shared by copies of the writer
+	renders *renderCache
 }
 
 func NewBundleWriter(loader BundleLoader, writer FileWriter) BundleWriter {
 	return BundleWriter{
 		FileWriter:   writer,
 		BundleLoader: loader,
+		renders:      newRenderCache(),
 	}
 }
 
+// SyncResult describes the contents written to a volume by Sync
+type SyncResult struct {
+	// Hash of the written files, including their paths and modes
+	Hash string
+	// Certificates is the number of certificates in the bundle
+	Certificates int
+	// NotAfter is the earliest expiry of the certificates in the bundle
+	NotAfter time.Time
+}
+
 // Sync will update the target directory with the latest bundle contents
-func (s BundleWriter) Sync(ctx context.Context, meta metadata.Metadata, target string) error {
+func (s BundleWriter) Sync(ctx context.Context, meta metadata.Metadata, target string) (_ SyncResult, err error) {
+	ctx, span := tracing.Start(ctx, "BundleWriter.Sync", trace.WithAttributes(
+		attribute.String("volume_id", meta.VolumeID),
+		attribute.String("bundle", meta.Bundle),
+		attribute.String("namespace", meta.PodNamespace),
+	))
+	start := time.Now()
+	defer func() {
+		observeSync(meta, time.Since(start), err)
+		tracing.End(span, err)
+	}()
+
 	// Load the bundle, this should return a slice containing PEM bundles
 	bundle, err := s.BundleLoader.Load(ctx, meta.PodNamespace, meta.Bundle)
 	if err != nil {
-		return err
+		return SyncResult{}, err
+	}
+
+	// Volumes of the same bundle in a namespace with the same outputs share
+	// the rendered files
+	r, err := s.render(ctx, meta, bundle)
+	if err != nil {
+		return SyncResult{}, err
+	}
+
+	// Write the files to disk
+	if err := s.FileWriter.Write(ctx, target, r.payload); err != nil {
+		return SyncResult{}, err
+	}
+
+	return r.result, nil
+}
+
+// PruneRenders drops the cached renders of the bundle for every namespace but
+// the given namespaces, which should be the namespaces with volumes of the
+// bundle.
+func (s BundleWriter) PruneRenders(bundle string, namespaces sets.Set[string]) {
+	if s.renders != nil {
+		s.renders.prune(bundle, namespaces)
+	}
+}
+
+// render renders the bundle for the outputs of the volume, returning the
+// cached render if the bundle was rendered for the same outputs before.
+func (s BundleWriter) render(ctx context.Context, meta metadata.Metadata, bundle []byte) (rendered, error) {
+	contentHash, outputs := hashContent(bundle), outputsKey(meta.Outputs)
+	if s.renders != nil {
+		if r, ok := s.renders.get(meta, contentHash, outputs); ok {
+			renderCacheLookups.WithLabelValues("hit").Inc()
+			return r, nil
+		}
+		renderCacheLookups.WithLabelValues("miss").Inc()
 	}
 
 	// Build payload for the file writer
 	payload := map[string]volumeutil.FileProjection{}
 	for _, output := range meta.Outputs {
-		var err error
-
-		switch output.Format {
-		case metadata.OutputFormatConcatenatedFile:
-			err = s.addConcatenatedFileToPayload(bundle, output, payload)
-		case metadata.OutputFormatOpenSSLRehash:
-			err = s.addRehashFilesToPayload(bundle, output, payload)
+		if err := s.renderOutput(ctx, bundle, output, payload); err != nil {
+			return rendered{}, err
 		}
+	}
 
-		if err != nil {
-			return err
+	result := SyncResult{}
+	if err := x509util.ForEachCertInBundle(bundle, func(cert *x509.Certificate, _ []byte) error {
+		result.Certificates++
+		if result.NotAfter.IsZero() || cert.NotAfter.Before(result.NotAfter) {
+			result.NotAfter = cert.NotAfter
 		}
+		return nil
+	}); err != nil {
+		return rendered{}, err
 	}
+	result.Hash = hashPayload(payload)
 
-	// Write the files to disk
-	if err := s.FileWriter.Write(ctx, target, payload); err != nil {
-		return err
+	r := rendered{payload: payload, result: result}
+	if s.renders != nil {
+		r = s.renders.add(meta, contentHash, outputs, r)
+	}
+
+	return r, nil
+}
+
+// renderOutput adds the files of the output to the payload.
+func (s BundleWriter) renderOutput(ctx context.Context, bundle []byte, output metadata.Output, payload map[string]volumeutil.FileProjection) (err error) {
+	_, span := tracing.Start(ctx, "BundleWriter.Render", trace.WithAttributes(
+		attribute.String("format", string(output.Format)),
+		attribute.String("path", output.Path),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	switch output.Format {
+	case metadata.OutputFormatConcatenatedFile:
+		return s.addConcatenatedFileToPayload(bundle, output, payload)
+	case metadata.OutputFormatOpenSSLRehash:
+		return s.addRehashFilesToPayload(bundle, output, payload)
 	}
 
 	return nil
 }
 
+// hashPayload returns a hash of the files in the payload, it changes whenever
+// the contents, path, mode or owner of any file changes.
+func hashPayload(payload map[string]volumeutil.FileProjection) string {
+	h := sha256.New()
+	for _, fpath := range slices.Sorted(maps.Keys(payload)) {
+		file := payload[fpath]
+		_, _ = fmt.Fprintf(h, "%s\x00%o\x00%s\x00%s\x00%d\x00", fpath, file.Mode, formatID(file.FsUser), formatID(file.FsGroup), len(file.Data))
+		_, _ = h.Write(file.Data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func formatID(id *int64) string {
+	if id == nil {
+		return ""
+	}
+	return strconv.FormatInt(*id, 10)
+}
+
 func (s BundleWriter) addConcatenatedFileToPayload(bundle []byte, output metadata.Output, payload map[string]volumeutil.FileProjection) error {
 	buffer := new(bytes.Buffer)
 
@@ -101,7 +217,7 @@ func (s BundleWriter) addConcatenatedFileToPayload(bundle []byte, output metadat
 	fpath := strings.TrimLeft(output.Path, "/")
 	payload[fpath] = volumeutil.FileProjection{
 		Data:    append(bytes.TrimSpace(buffer.Bytes()), '\n'),
-		Mode:    0440,
+		Mode:    fileMode(output),
 		FsUser:  output.UID,
 		FsGroup: output.GID,
 	}
@@ -130,7 +246,7 @@ func (s BundleWriter) addRehashFilesToPayload(bundle []byte, output metadata.Out
 		// Add to the payload
 		payload[fpath] = volumeutil.FileProjection{
 			Data:    pem,
-			Mode:    0440,
+			Mode:    fileMode(output),
 			FsUser:  output.UID,
 			FsGroup: output.GID,
 		}
@@ -138,3 +254,11 @@ func (s BundleWriter) addRehashFilesToPayload(bundle []byte, output metadata.Out
 		return nil
 	})
 }
+
+func fileMode(output metadata.Output) int32 {
+	if output.Mode != nil {
+		return *output.Mode
+	}
+
+	return DefaultFileMode
+}
@@ -19,6 +19,10 @@ package bundlewriter
 import (
 	"context"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 	volumeutil "github.com/cert-manager/trust-manager-csi-driver/third_party/k8s.io/kubernetes/pkg/volume/util"
 )
 
@@ -26,7 +30,8 @@ import (
 type FileProjection = volumeutil.FileProjection
 
 // FileWriter is used to write files to a given directory, this will wipe
-// existing files and replace them with the given payload.
+// existing files and replace them with the given payload. The payload is
+// shared between volumes and must not be modified.
 type FileWriter interface {
 	Write(ctx context.Context, target string, payload map[string]FileProjection) error
 }
@@ -39,7 +44,13 @@ func NewAtomicFileWriter() FileWriter {
 
 type atomicWriter struct{}
 
-func (w atomicWriter) Write(ctx context.Context, target string, payload map[string]FileProjection) error {
+func (w atomicWriter) Write(ctx context.Context, target string, payload map[string]FileProjection) (err error) {
+	_, span := tracing.Start(ctx, "FileWriter.Write", trace.WithAttributes(
+		attribute.String("target", target),
+		attribute.Int("files", len(payload)),
+	))
+	defer func() { tracing.End(span, err) }()
+
 	atomicWriter, err := volumeutil.NewAtomicWriter(target, "trust-manager-csi-driver")
 	if err != nil {
 		return err
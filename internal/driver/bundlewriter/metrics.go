@@ -0,0 +1,63 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundlewriter
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+var (
+	syncsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_syncs_total",
+		Help: "Number of times a bundle was synced to a volume.",
+	}, []string{"bundle", "namespace"})
+
+	syncFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_sync_failures_total",
+		Help: "Number of times syncing a bundle to a volume failed.",
+	}, []string{"bundle", "namespace"})
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trust_manager_csi_driver_sync_duration_seconds",
+		Help:    "Time taken to sync a bundle to a volume, including loading the bundle.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"bundle", "namespace"})
+
+	renderCacheLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_render_cache_lookups_total",
+		Help: "Number of lookups of rendered bundles, by whether the bundle had already been rendered for the outputs.",
+	}, []string{"result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(syncsTotal, syncFailuresTotal, syncDuration, renderCacheLookups)
+}
+
+// observeSync records a sync of the volume, the metrics are labelled by the
+// bundle and namespace and not the volume to keep the cardinality low.
+func observeSync(meta metadata.Metadata, duration time.Duration, err error) {
+	syncsTotal.WithLabelValues(meta.Bundle, meta.PodNamespace).Inc()
+	syncDuration.WithLabelValues(meta.Bundle, meta.PodNamespace).Observe(duration.Seconds())
+	if err != nil {
+		syncFailuresTotal.WithLabelValues(meta.Bundle, meta.PodNamespace).Inc()
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundlewriter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+// maxRendersPerBundle bounds the number of distinct outputs cached for the
+// contents of a bundle in a namespace, as Pods are free to choose any path
+const maxRendersPerBundle = 64
+
+// rendered is a bundle rendered for a set of outputs
+type rendered struct {
+	payload map[string]FileProjection
+	result  SyncResult
+}
+
+type renderCacheKey struct {
+	bundle    string
+	namespace string
+}
+
+type renderCacheEntry struct {
+	contentHash string
+	renders     map[string]rendered
+}
+
+// renderCache caches the rendered files of bundles, so certificates are
+// parsed once per bundle, namespace, bundle contents and outputs instead of
+// once per volume. The payloads are shared between volumes and must not be
+// modified.
+//
+// Only the renders of the latest contents of a bundle in a namespace are
+// kept, older contents are dropped as soon as new contents are rendered. The
+// renders of a bundle in a namespace without volumes are dropped by prune.
+type renderCache struct {
+	mu      sync.Mutex
+	entries map[renderCacheKey]*renderCacheEntry
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{entries: make(map[renderCacheKey]*renderCacheEntry)}
+}
+
+// get returns the cached render of the bundle contents for the outputs.
+func (c *renderCache) get(meta metadata.Metadata, contentHash, outputs string) (rendered, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[renderCacheKey{bundle: meta.Bundle, namespace: meta.PodNamespace}]
+	if !ok || entry.contentHash != contentHash {
+		return rendered{}, false
+	}
+
+	r, ok := entry.renders[outputs]
+	return r, ok
+}
+
+// add caches the render of the bundle contents for the outputs, returning
+// the render cached by a concurrent sync if it was added first, so the volumes
+// share it.
+func (c *renderCache) add(meta metadata.Metadata, contentHash, outputs string, r rendered) rendered {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := renderCacheKey{bundle: meta.Bundle, namespace: meta.PodNamespace}
+	entry, ok := c.entries[key]
+	if !ok || entry.contentHash != contentHash || len(entry.renders) >= maxRendersPerBundle {
+		entry = &renderCacheEntry{contentHash: contentHash, renders: make(map[string]rendered)}
+		c.entries[key] = entry
+	}
+
+	if cached, ok := entry.renders[outputs]; ok {
+		return cached
+	}
+	entry.renders[outputs] = r
+	return r
+}
+
+// prune drops the renders of the bundle in every namespace but the given
+// namespaces.
+func (c *renderCache) prune(bundle string, namespaces sets.Set[string]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key := range c.entries {
+		if key.bundle == bundle && !namespaces.Has(key.namespace) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// hashContent returns a hash of the bundle as loaded.
+func hashContent(bundle []byte) string {
+	sum := sha256.Sum256(bundle)
+	return hex.EncodeToString(sum[:])
+}
+
+// outputsKey returns a key identifying the outputs, outputs with the same key
+// render to the same files.
+func outputsKey(outputs []metadata.Output) string {
+	h := sha256.New()
+	for _, output := range outputs {
+		_, _ = fmt.Fprintf(h, "%s\x00%s\x00%o\x00%s\x00%s\x00", output.Format, output.Path, fileMode(output), formatID(output.UID), formatID(output.GID))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
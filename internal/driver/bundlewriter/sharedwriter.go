@@ -0,0 +1,192 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundlewriter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/utils/ptr"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
+	volumeutil "github.com/cert-manager/trust-manager-csi-driver/third_party/k8s.io/kubernetes/pkg/volume/util"
+)
+
+// NewSharedFileWriter returns a FileWriter that stores every unique payload
+// once in the store directory, named after the hash of the payload, and hard
+// links the files into the target directories. Volumes with identical files
+// share the same inodes, so the files only take up memory in the tmpfs once.
+//
+// The store directory must be on the same filesystem as the targets. Entries
+// are never removed by the writer, the garbage collector removes the entries
+// no volume was synced with. Writes hold a read lock of storeLock from looking
+// up an entry until its files are linked, the garbage collector holds the
+// write lock while removing entries so an entry is not removed before it is
+// linked.
+func NewSharedFileWriter(storeDir string, storeLock *sync.RWMutex) FileWriter {
+	return &sharedWriter{storeDir: storeDir, storeLock: storeLock}
+}
+
+type sharedWriter struct {
+	storeDir string
+
+	// storeLock is shared with the garbage collector removing entries
+	storeLock *sync.RWMutex
+
+	// mu serializes creating entries in the store
+	mu sync.Mutex
+}
+
+func (w *sharedWriter) Write(ctx context.Context, target string, payload map[string]FileProjection) (err error) {
+	_, span := tracing.Start(ctx, "FileWriter.Write", trace.WithAttributes(
+		attribute.String("target", target),
+		attribute.Int("files", len(payload)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	w.storeLock.RLock()
+	defer w.storeLock.RUnlock()
+
+	entry, err := w.ensureEntry(payload)
+	if err != nil {
+		return err
+	}
+
+	atomicWriter, err := volumeutil.NewAtomicWriter(target, "trust-manager-csi-driver")
+	if err != nil {
+		return err
+	}
+
+	// Swapping the data directory is atomic, same as when the files are
+	// written
+	return atomicWriter.WriteLinked(payload, entry)
+}
+
+// ensureEntry returns the store entry of the payload, creating it if it does
+// not exist. An entry whose files were modified is replaced, volumes linked to
+// the modified files are linked to the new entry on their next write.
+func (w *sharedWriter) ensureEntry(payload map[string]FileProjection) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entry := filepath.Join(w.storeDir, hashPayload(payload))
+	valid, err := entryMatches(entry, payload)
+	if err != nil {
+		return "", err
+	}
+	if valid {
+		return entry, nil
+	}
+
+	if err := os.MkdirAll(w.storeDir, 0700); err != nil {
+		return "", fmt.Errorf("could not create store: %w", err)
+	}
+
+	// Write the files next to the entry, so it appears complete
+	tmp, err := os.MkdirTemp(w.storeDir, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("could not create store entry: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := writeEntry(tmp, payload); err != nil {
+		return "", fmt.Errorf("could not write store entry: %w", err)
+	}
+
+	// Move a modified entry out of the way, volumes linked to its files keep
+	// them until they are linked to the new entry
+	if _, err := os.Lstat(entry); err == nil {
+		stale, err := os.MkdirTemp(w.storeDir, ".stale-")
+		if err != nil {
+			return "", fmt.Errorf("could not replace store entry: %w", err)
+		}
+		defer os.RemoveAll(stale)
+
+		if err := os.Rename(entry, filepath.Join(stale, "entry")); err != nil {
+			return "", fmt.Errorf("could not replace store entry: %w", err)
+		}
+	}
+
+	if err := os.Rename(tmp, entry); err != nil {
+		return "", fmt.Errorf("could not create store entry: %w", err)
+	}
+
+	return entry, nil
+}
+
+// entryMatches returns whether every file of the payload exists in the entry
+// with the same contents, mode and owner.
+func entryMatches(entry string, payload map[string]FileProjection) (bool, error) {
+	for fpath, file := range payload {
+		info, err := os.Lstat(filepath.Join(entry, fpath))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if !info.Mode().IsRegular() || info.Mode().Perm() != os.FileMode(file.Mode).Perm() || !volumeutil.OwnerMatches(info, file) {
+			return false, nil
+		}
+
+		data, err := os.ReadFile(filepath.Join(entry, fpath))
+		if err != nil {
+			return false, err
+		}
+		if !bytes.Equal(data, file.Data) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// writeEntry writes the files of the payload to the directory.
+func writeEntry(dir string, payload map[string]FileProjection) error {
+	for fpath, file := range payload {
+		fullPath := filepath.Join(dir, fpath)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+			return err
+		}
+
+		mode := os.FileMode(file.Mode)
+		if err := os.WriteFile(fullPath, file.Data, mode); err != nil {
+			return err
+		}
+		// The umask applies to WriteFile
+		if err := os.Chmod(fullPath, mode); err != nil {
+			return err
+		}
+
+		// Same as the atomic writer, either id may be set on its own
+		if file.FsUser == nil && file.FsGroup == nil {
+			continue
+		}
+		if err := os.Chown(fullPath, int(ptr.Deref(file.FsUser, -1)), int(ptr.Deref(file.FsGroup, -1))); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
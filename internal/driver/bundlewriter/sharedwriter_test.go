@@ -0,0 +1,135 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bundlewriter_test
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+)
+
+func TestSharedFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	storeDir := filepath.Join(dir, ".store")
+	writer := bundlewriter.NewSharedFileWriter(storeDir, new(sync.RWMutex))
+
+	payload := map[string]bundlewriter.FileProjection{
+		"ca.crt": {Mode: 0644, Data: []byte("certificates")},
+	}
+
+	targets := []string{filepath.Join(dir, "volume-a"), filepath.Join(dir, "volume-b")}
+	for _, target := range targets {
+		if err := os.MkdirAll(target, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Write(t.Context(), target, payload); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	stat := func(path string) os.FileInfo {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info
+	}
+
+	a := stat(filepath.Join(targets[0], "ca.crt"))
+	b := stat(filepath.Join(targets[1], "ca.crt"))
+	if !os.SameFile(a, b) {
+		t.Fatalf("expected volumes with identical files to share them")
+	}
+
+	entries, err := os.ReadDir(storeDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a single store entry, got %d", len(entries))
+	}
+
+	// A modified store entry must not be linked into other volumes
+	entry := filepath.Join(storeDir, entries[0].Name(), "ca.crt")
+	if err := os.WriteFile(entry, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range targets {
+		if err := writer.Write(t.Context(), target, payload); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		data, err := os.ReadFile(filepath.Join(target, "ca.crt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "certificates" {
+			t.Errorf("expected %s to be restored, got %q", target, data)
+		}
+	}
+
+	// Files with a different mode are not shared
+	payload = map[string]bundlewriter.FileProjection{
+		"ca.crt": {Mode: 0600, Data: []byte("certificates")},
+	}
+	if err := writer.Write(t.Context(), targets[1], payload); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	a = stat(filepath.Join(targets[0], "ca.crt"))
+	b = stat(filepath.Join(targets[1], "ca.crt"))
+	if os.SameFile(a, b) {
+		t.Errorf("expected files with different modes not to be shared")
+	}
+	if b.Mode().Perm() != 0600 {
+		t.Errorf("expected mode 0600, got %s", b.Mode().Perm())
+	}
+}
+
+func TestSharedFileWriterOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of files requires root")
+	}
+
+	dir := t.TempDir()
+	writer := bundlewriter.NewSharedFileWriter(filepath.Join(dir, ".store"), new(sync.RWMutex))
+
+	target := filepath.Join(dir, "volume")
+	if err := os.MkdirAll(target, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, gid := range []int64{1234, 5678} {
+		payload := map[string]bundlewriter.FileProjection{
+			"ca.crt": {Mode: 0440, Data: []byte("certificates"), FsGroup: &gid},
+		}
+		if err := writer.Write(t.Context(), target, payload); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		info, err := os.Stat(filepath.Join(target, "ca.crt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stat := info.Sys().(*syscall.Stat_t); int64(stat.Gid) != gid || int(stat.Uid) != os.Getuid() {
+			t.Errorf("expected owner %d:%d, got %d:%d", os.Getuid(), gid, stat.Uid, stat.Gid)
+		}
+	}
+}
@@ -16,10 +16,27 @@ limitations under the License.
 
 package config
 
-import "path"
+import (
+	"path"
+	"strings"
+	"time"
+)
 
 const (
 	MetadataFileName = "metadata"
+
+	// QuarantineDirName is the directory in the tmpfs volumes are moved to
+	// when their metadata can't be loaded
+	QuarantineDirName = ".quarantine"
+
+	// StoreDirName is the directory in the tmpfs shared files are stored in
+	StoreDirName = ".store"
+
+	// StorageModeCopy writes a copy of the files to every volume
+	StorageModeCopy = "copy"
+	// StorageModeShared stores identical files once, hard linking them into
+	// every volume
+	StorageModeShared = "shared"
 )
 
 // Config is the config for the CSI driver
@@ -28,6 +45,35 @@ type Config struct {
 	DataDir      string
 	GRPCEndpoint string
 	DriverName   string
+	// PolicyFile is the path to the policy declaring which namespaces may
+	// mount which Bundles, if empty every Bundle may be mounted.
+	PolicyFile string
+	// GCInterval is the interval between garbage collections of orphaned
+	// volumes, zero disables garbage collection.
+	GCInterval time.Duration
+	// StartupResyncTimeout is how long the driver waits for the volumes
+	// loaded on start up to be resynced before reporting ready.
+	StartupResyncTimeout time.Duration
+	// ResyncInterval is the interval between resyncs of every volume, zero
+	// disables periodic resyncs.
+	ResyncInterval time.Duration
+	// MigrateMetadata rewrites the metadata of volumes loaded on start up if
+	// it was stored in an older version.
+	MigrateMetadata bool
+	// StorageMode is either StorageModeCopy or StorageModeShared
+	StorageMode string
+	// SyncWorkers is the number of volumes synced concurrently, shared by
+	// the initial syncs of volumes being published and Bundle updates.
+	SyncWorkers int
+	// MaxConcurrentReconciles is the number of Bundles reconciled
+	// concurrently.
+	MaxConcurrentReconciles int
+	// DebugAddress is the TCP address the debug endpoint is served on, the
+	// value "0" disables it.
+	DebugAddress string
+	// InsecureDebugEndpoint serves the debug endpoint over HTTP without
+	// requiring clients to authenticate.
+	InsecureDebugEndpoint bool
 }
 
 func (c Config) MetadataPathForVolume(id string) string {
@@ -42,6 +88,25 @@ func (c Config) RootPathForVolume(id string) string {
 	return path.Join(c.TmpFSPath(), id)
 }
 
+func (c Config) QuarantinePath() string {
+	return path.Join(c.TmpFSPath(), QuarantineDirName)
+}
+
+// SharedStorage returns whether identical files are stored once.
+func (c Config) SharedStorage() bool {
+	return c.StorageMode == StorageModeShared
+}
+
+func (c Config) StorePath() string {
+	return path.Join(c.TmpFSPath(), StoreDirName)
+}
+
+// IsHidden returns whether an entry in the tmpfs is hidden, hidden entries are
+// not volumes.
+func IsHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
 func (c Config) TmpFSPath() string {
 	return path.Join(c.DataDir, "tmpfs")
 }
@@ -18,20 +18,30 @@ package controller
 
 import (
 	"context"
+	"sync"
 
 	trustapi "github.com/cert-manager/trust-manager/pkg/apis/trust/v1alpha1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clientevents "k8s.io/client-go/tools/events"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	crcontroller "sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/events"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 )
 
 type Reconciler struct {
@@ -39,34 +49,142 @@ type Reconciler struct {
 	State        *state.State
 	Client       client.Client
 	BundleWriter bundlewriter.BundleWriter
+	Recorder     clientevents.EventRecorder
+
+	// StartupResync is notified of synced bundles, if set
+	StartupResync *StartupResync
+	// Watchdog tracks the reconciles in progress, if set
+	Watchdog *Watchdog
+	// PeriodicResync resyncs every volume on an interval, if set
+	PeriodicResync *PeriodicResync
+	// Workers bounds the number of volumes synced concurrently, if set
+	Workers *syncpool.Pool
+	// MaxConcurrentReconciles is the number of bundles reconciled
+	// concurrently, the controller-runtime default is used if zero
+	MaxConcurrentReconciles int
 }
 
-func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	// Sync the volume, collect any errors into a slice.
-	errs := []error{}
-	for _, meta := range r.State.GetMetadataForBundle(req.Name) {
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, err error) {
+	ctx, span := tracing.Start(ctx, "Reconcile", trace.WithAttributes(attribute.String("bundle", req.Name)))
+	defer func() { tracing.End(span, err) }()
+
+	if r.Watchdog != nil {
+		defer r.Watchdog.Start(req.Name)()
+	}
+
+	// Volumes in the same namespace share the loaded bundle, and volumes with
+	// the same outputs share the rendered files
+	bundleWriter := r.BundleWriter
+	bundleWriter.BundleLoader = bundlewriter.NewMemoizedLoader(bundleWriter.BundleLoader)
+
+	// Renders of the bundle are only kept for namespaces with volumes left,
+	// so they are dropped once the last volume in a namespace is unpublished
+	volumes := r.State.GetMetadataForBundle(req.Name)
+	namespaces := sets.New[string]()
+	for _, meta := range volumes {
+		namespaces.Insert(meta.PodNamespace)
+	}
+	bundleWriter.PruneRenders(req.Name, namespaces)
+
+	// Sync the volumes in parallel, bounded by the workers shared with the
+	// initial syncs of volumes being published. Collect any errors into a
+	// slice.
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, meta := range volumes {
 		ctx := log.IntoContext(ctx,
 			log.FromContext(ctx).
 				WithValues(
 					"volume_id", meta.VolumeID,
-				),
+				).
+				WithValues(meta.PodKeysAndValues()...),
 		)
 
-		if err := r.BundleWriter.Sync(ctx, meta, r.Config.DataPathForVolume(meta.VolumeID)); err != nil {
-			errs = append(errs, err)
-		}
+		wg.Go(func() {
+			// The volume is locked before waiting for a worker, same as when
+			// publishing, so a worker is never held waiting for the lock
+			defer r.State.LockVolume(meta.VolumeID)()
+
+			// The volume may have been unpublished, or published again, while
+			// waiting for the lock
+			meta, synced := r.State.GetSyncedMetadata(meta.VolumeID)
+			if !synced || meta.Bundle != req.Name {
+				return
+			}
+
+			var err error
+			if poolErr := r.Workers.Do(ctx, syncpool.PriorityBackground, func() {
+				err = r.syncVolume(ctx, bundleWriter, meta)
+			}); poolErr != nil {
+				err = poolErr
+			}
+
+			if err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return ctrl.Result{}, errors.NewAggregate(errs)
+	}
+
+	if r.StartupResync != nil {
+		r.StartupResync.Synced(req.Name)
 	}
 
-	// Return the error aggregate
-	return ctrl.Result{}, errors.NewAggregate(errs)
+	return ctrl.Result{}, nil
+}
+
+// syncVolume syncs the bundle to the volume, recording the result in the
+// state. The volume must be locked.
+func (r *Reconciler) syncVolume(ctx context.Context, bundleWriter bundlewriter.BundleWriter, meta metadata.Metadata) error {
+	result, err := bundleWriter.Sync(ctx, meta, r.Config.DataPathForVolume(meta.VolumeID))
+	if err != nil {
+		r.State.SetSyncFailed(meta.VolumeID, err)
+		events.Eventf(r.Recorder, meta, corev1.EventTypeWarning, events.ReasonTrustBundleSyncFailed, events.ActionSyncVolume,
+			"Failed to sync trust bundle %q: %s", meta.Bundle, err)
+		return err
+	}
+
+	previous, err := r.State.SetSynced(meta.VolumeID, result)
+	if err != nil {
+		return err
+	}
+
+	// Volumes without a previous hash were published by an older version
+	// of the driver, so whether anything changed is unknown
+	if previous.LastSyncedHash != "" && previous.LastSyncedHash != result.Hash {
+		log.FromContext(ctx).Info("trust bundle updated", "old_certificates", previous.LastSyncedCertificates, "new_certificates", result.Certificates)
+		events.Eventf(r.Recorder, meta, corev1.EventTypeNormal, events.ReasonTrustBundleUpdated, events.ActionSyncVolume,
+			"Trust bundle %q updated from %d to %d certificates", meta.Bundle, previous.LastSyncedCertificates, result.Certificates)
+	}
+
+	return nil
 }
 
 func (r *Reconciler) SetupWithManager(mgr manager.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.bundleForSecretOrConfigMap)).
 		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.bundleForSecretOrConfigMap)).
 		Named("bundle").
-		Complete(r)
+		WithOptions(crcontroller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles})
+
+	if r.StartupResync != nil {
+		b = b.WatchesRawSource(r.StartupResync.Source())
+	}
+
+	if r.PeriodicResync != nil {
+		b = b.WatchesRawSource(r.PeriodicResync.Source())
+	}
+
+	return b.Complete(r)
 }
 
 func (r *Reconciler) bundleForSecretOrConfigMap(ctx context.Context, obj client.Object) []reconcile.Request {
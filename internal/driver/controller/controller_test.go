@@ -0,0 +1,363 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	clientevents "k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+)
+
+type fakeLoader struct {
+	bundle []byte
+	err    error
+}
+
+func (l *fakeLoader) Load(context.Context, string, string) ([]byte, error) {
+	return l.bundle, l.err
+}
+
+type fakeWriter struct{}
+
+func (fakeWriter) Write(context.Context, string, map[string]bundlewriter.FileProjection) error {
+	return nil
+}
+
+func TestReconcileEvents(t *testing.T) {
+	s, cfg := newState(t)
+
+	meta := metadata.Metadata{
+		VolumeID:     "volume",
+		PodNamespace: "namespace",
+		PodName:      "pod",
+		PodUID:       "uid",
+		Bundle:       "bundle",
+		Outputs:      []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"}},
+	}
+	if err := os.MkdirAll(cfg.RootPathForVolume("volume"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Track(meta); err != nil {
+		t.Fatal(err)
+	}
+
+	one := readCert(t, "002c0b4f")
+	two := append(readCert(t, "002c0b4f"), readCert(t, "0179095f")...)
+
+	loader := &fakeLoader{}
+	recorder := clientevents.NewFakeRecorder(10)
+	r := &controller.Reconciler{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(loader, fakeWriter{}),
+		Recorder:     recorder,
+	}
+
+	tests := []struct {
+		name          string
+		bundle        []byte
+		err           error
+		expectedEvent string
+	}{
+		// The volume has no previous hash, so whether it changed is unknown
+		{name: "first sync", bundle: one},
+		{name: "unchanged", bundle: one},
+		{name: "certificate added", bundle: two, expectedEvent: `Normal TrustBundleUpdated Trust bundle "bundle" updated from 1 to 2 certificates`},
+		{name: "load failure", err: errors.New("boom"), expectedEvent: `Warning TrustBundleSyncFailed Failed to sync trust bundle "bundle": boom`},
+		{name: "certificate removed", bundle: one, expectedEvent: `Normal TrustBundleUpdated Trust bundle "bundle" updated from 2 to 1 certificates`},
+	}
+
+	for _, test := range tests {
+		loader.bundle, loader.err = test.bundle, test.err
+
+		_, err := r.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}})
+		if (err != nil) != (test.err != nil) {
+			t.Fatalf("%s: expected error %v, got %v", test.name, test.err, err)
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if event != test.expectedEvent {
+				t.Fatalf("%s: expected event %q, got %q", test.name, test.expectedEvent, event)
+			}
+		default:
+			if test.expectedEvent != "" {
+				t.Fatalf("%s: expected event %q, got none", test.name, test.expectedEvent)
+			}
+		}
+	}
+}
+
+type countingLoader struct {
+	bundle []byte
+	loads  map[string]int
+}
+
+func (l *countingLoader) Load(_ context.Context, namespace, _ string) ([]byte, error) {
+	l.loads[namespace]++
+	return l.bundle, nil
+}
+
+type recordingWriter struct {
+	mu       sync.Mutex
+	payloads map[string]map[string]bundlewriter.FileProjection
+}
+
+func (w *recordingWriter) Write(_ context.Context, target string, payload map[string]bundlewriter.FileProjection) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.payloads[target] = payload
+	return nil
+}
+
+func TestReconcileSharesRenders(t *testing.T) {
+	s, cfg := newState(t)
+
+	concatenated := []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"}}
+	rehash := []metadata.Output{{Format: metadata.OutputFormatOpenSSLRehash, Path: "/certs"}}
+
+	volumes := []metadata.Metadata{
+		{VolumeID: "a-1", PodNamespace: "a", Bundle: "bundle", Outputs: concatenated},
+		{VolumeID: "a-2", PodNamespace: "a", Bundle: "bundle", Outputs: concatenated},
+		{VolumeID: "a-3", PodNamespace: "a", Bundle: "bundle", Outputs: rehash},
+		{VolumeID: "b-1", PodNamespace: "b", Bundle: "bundle", Outputs: concatenated},
+	}
+	for _, meta := range volumes {
+		if err := os.MkdirAll(cfg.RootPathForVolume(meta.VolumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	loader := &countingLoader{bundle: readCert(t, "002c0b4f"), loads: map[string]int{}}
+	writer := &recordingWriter{payloads: map[string]map[string]bundlewriter.FileProjection{}}
+	r := &controller.Reconciler{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(loader, writer),
+	}
+
+	for i := range 2 {
+		if _, err := r.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		// The bundle is loaded once per namespace on every reconcile
+		if expected := map[string]int{"a": i + 1, "b": i + 1}; !maps.Equal(loader.loads, expected) {
+			t.Fatalf("reconcile %d: expected loads %v, got %v", i, expected, loader.loads)
+		}
+	}
+
+	payload := func(volumeID string) uintptr {
+		p, ok := writer.payloads[cfg.DataPathForVolume(volumeID)]
+		if !ok {
+			t.Fatalf("volume %q was not written", volumeID)
+		}
+		return reflect.ValueOf(p).Pointer()
+	}
+
+	if payload("a-1") != payload("a-2") {
+		t.Errorf("expected volumes with the same outputs to share the rendered files")
+	}
+	if payload("a-1") == payload("a-3") {
+		t.Errorf("expected volumes with different outputs to be rendered separately")
+	}
+	if payload("a-1") == payload("b-1") {
+		t.Errorf("expected volumes in different namespaces to be rendered separately")
+	}
+
+	for _, volumeID := range []string{"a-1", "a-3", "b-1"} {
+		if status := s.GetStatus(volumeID); status.Certificates != 1 || status.Hash == "" {
+			t.Errorf("volume %q: unexpected status %+v", volumeID, status)
+		}
+	}
+}
+
+func TestReconcilePrunesRenders(t *testing.T) {
+	s, cfg := newState(t)
+
+	meta := metadata.Metadata{
+		VolumeID:     "volume",
+		PodNamespace: "namespace",
+		Bundle:       "bundle",
+		Outputs:      []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"}},
+	}
+	if err := os.MkdirAll(cfg.RootPathForVolume(meta.VolumeID), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := &recordingWriter{payloads: map[string]map[string]bundlewriter.FileProjection{}}
+	r := &controller.Reconciler{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(&fakeLoader{bundle: readCert(t, "002c0b4f")}, writer),
+	}
+
+	reconcile := func() uintptr {
+		t.Helper()
+
+		if err := s.Track(meta); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}}); err != nil {
+			t.Fatal(err)
+		}
+		p, ok := writer.payloads[cfg.DataPathForVolume(meta.VolumeID)]
+		if !ok {
+			t.Fatalf("volume was not written")
+		}
+		return reflect.ValueOf(p).Pointer()
+	}
+
+	first := reconcile()
+	if reconcile() != first {
+		t.Fatalf("expected the render to be cached while the volume is tracked")
+	}
+
+	// Reconciling the bundle once the last volume in the namespace is
+	// untracked drops the render, so the volume published again is rendered
+	// again
+	s.Untrack(meta.VolumeID)
+	if _, err := r.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}}); err != nil {
+		t.Fatal(err)
+	}
+	if reconcile() == first {
+		t.Errorf("expected the render to be dropped after the last volume was untracked")
+	}
+}
+
+// blockingWriter records the number of concurrent writes, each write
+// blocks until released.
+type blockingWriter struct {
+	release  chan struct{}
+	started  chan struct{}
+	running  atomic.Int32
+	observed atomic.Int32
+}
+
+func (w *blockingWriter) Write(context.Context, string, map[string]bundlewriter.FileProjection) error {
+	running := w.running.Add(1)
+	defer w.running.Add(-1)
+	for {
+		observed := w.observed.Load()
+		if running <= observed || w.observed.CompareAndSwap(observed, running) {
+			break
+		}
+	}
+
+	w.started <- struct{}{}
+	<-w.release
+	return nil
+}
+
+func TestReconcileBoundedWorkers(t *testing.T) {
+	s, cfg := newState(t)
+
+	for i := range 5 {
+		meta := metadata.Metadata{
+			VolumeID:     fmt.Sprintf("volume-%d", i),
+			PodNamespace: "namespace",
+			Bundle:       "bundle",
+			Outputs:      []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"}},
+		}
+		if err := os.MkdirAll(cfg.RootPathForVolume(meta.VolumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writer := &blockingWriter{release: make(chan struct{}), started: make(chan struct{})}
+	workers := syncpool.New(2)
+	r := &controller.Reconciler{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(&fakeLoader{bundle: readCert(t, "002c0b4f")}, writer),
+		Workers:      workers,
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := r.Reconcile(t.Context(), ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}})
+		done <- err
+	}()
+
+	// Wait for both workers to be busy, then publish a volume
+	<-writer.started
+	<-writer.started
+
+	published := make(chan struct{})
+	go func() {
+		_ = workers.Do(t.Context(), syncpool.PriorityPublish, func() { close(published) })
+	}()
+
+	// Give the publish time to queue behind the background syncs
+	time.Sleep(50 * time.Millisecond)
+
+	// The first worker released must be handed to the publish, before the
+	// remaining volumes of the bundle
+	writer.release <- struct{}{}
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the publish to be handed the first free worker")
+	}
+
+	// Release the write still running and the remaining volumes
+	close(writer.release)
+	go func() {
+		for range 3 {
+			<-writer.started
+		}
+	}()
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if observed := writer.observed.Load(); observed != 2 {
+		t.Errorf("expected 2 concurrent writes, got %d", observed)
+	}
+}
+
+func readCert(t *testing.T, name string) []byte {
+	data, err := os.ReadFile("../../utils/x509/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
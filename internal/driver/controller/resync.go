@@ -0,0 +1,76 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+// resyncJitter is the maximum fraction the interval between resyncs is
+// extended by, so the drivers on different nodes don't resync in lockstep
+const resyncJitter = 0.1
+
+// PeriodicResync syncs every volume on an interval, even if no event was
+// received for its bundle. This recovers from missed watch events, e.g. across
+// API server disconnects, and from files in the volume being modified or
+// removed on disk.
+//
+// Resyncs are cheap when nothing changed, the files are only rewritten if
+// their contents or mode differ from the bundle.
+type PeriodicResync struct {
+	State *state.State
+	// Interval between resyncs
+	Interval time.Duration
+}
+
+// Source enqueues every bundle in the state on each interval.
+func (p *PeriodicResync) Source() source.Source {
+	return source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go p.run(ctx, queue)
+		return nil
+	})
+}
+
+func (p *PeriodicResync) run(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	logger := log.FromContext(ctx).WithName("periodic-resync")
+
+	for {
+		timer := time.NewTimer(wait.Jitter(p.Interval, resyncJitter))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		bundles := p.State.Bundles()
+		logger.V(2).Info("resyncing bundles", "bundles", len(bundles))
+		for _, bundle := range bundles {
+			queue.Add(reconcile.Request{NamespacedName: client.ObjectKey{Name: bundle}})
+		}
+	}
+}
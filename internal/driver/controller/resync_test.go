@@ -0,0 +1,51 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+)
+
+func TestPeriodicResync(t *testing.T) {
+	s, _ := newState(t, "bundle-a", "bundle-b")
+	resync := &controller.PeriodicResync{State: s, Interval: 10 * time.Millisecond}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+
+	if err := resync.Source().Start(t.Context(), queue); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every bundle is enqueued again on each interval
+	enqueued := map[string]int{}
+	for enqueued["bundle-a"] < 2 || enqueued["bundle-b"] < 2 {
+		req, _ := queue.Get()
+		if !slices.Contains([]string{"bundle-a", "bundle-b"}, req.Name) {
+			t.Fatalf("unexpected bundle %q enqueued", req.Name)
+		}
+		enqueued[req.Name]++
+		queue.Done(req)
+	}
+}
@@ -17,18 +17,43 @@ limitations under the License.
 package controller
 
 import (
+	"fmt"
+
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
 )
 
-func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundlewriter.BundleWriter) error {
+func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundlewriter.BundleWriter, workers *syncpool.Pool, watchdog *Watchdog) error {
+	startupResync := &StartupResync{
+		State:            state,
+		WaitForCacheSync: mgr.GetCache().WaitForCacheSync,
+		Timeout:          config.StartupResyncTimeout,
+	}
+
+	if err := mgr.AddReadyzCheck("startup-resync", startupResync.ReadyzCheck); err != nil {
+		return fmt.Errorf("could not add startup resync readyz check: %w", err)
+	}
+
+	var periodicResync *PeriodicResync
+	if config.ResyncInterval > 0 {
+		periodicResync = &PeriodicResync{State: state, Interval: config.ResyncInterval}
+	}
+
 	return (&Reconciler{
-		Config:       config,
-		Client:       mgr.GetClient(),
-		BundleWriter: bw,
-		State:        state,
+		Config:         config,
+		Client:         mgr.GetClient(),
+		BundleWriter:   bw,
+		Recorder:       mgr.GetEventRecorder(config.DriverName),
+		State:          state,
+		StartupResync:  startupResync,
+		Watchdog:       watchdog,
+		PeriodicResync: periodicResync,
+		Workers:        workers,
+
+		MaxConcurrentReconciles: config.MaxConcurrentReconciles,
 	}).SetupWithManager(mgr)
 }
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+// StartupResync syncs every volume loaded from a previous instance of the
+// driver once, since bundles may have changed while the driver was not
+// running and no event would be received for those changes.
+//
+// The driver is not ready until every bundle has been synced, or the timeout
+// has passed.
+type StartupResync struct {
+	State *state.State
+	// WaitForCacheSync blocks until the informer caches have synced
+	WaitForCacheSync func(context.Context) bool
+	// Timeout after which the driver is ready, even if not every bundle has
+	// been synced
+	Timeout time.Duration
+
+	mu       sync.Mutex
+	started  bool
+	finished bool
+	pending  sets.Set[string]
+}
+
+// Source enqueues every bundle in the state once the caches have synced.
+func (s *StartupResync) Source() source.Source {
+	return source.Func(func(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+		go s.enqueue(ctx, queue)
+		return nil
+	})
+}
+
+func (s *StartupResync) enqueue(ctx context.Context, queue workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	logger := log.FromContext(ctx).WithName("startup-resync")
+
+	if !s.WaitForCacheSync(ctx) {
+		return
+	}
+
+	bundles := s.State.Bundles()
+	logger.Info("resyncing bundles of existing volumes", "bundles", len(bundles))
+
+	s.mu.Lock()
+	s.started = true
+	s.pending = sets.New(bundles...)
+	s.finished = s.pending.Len() == 0
+	s.mu.Unlock()
+
+	for _, bundle := range bundles {
+		queue.Add(reconcile.Request{NamespacedName: client.ObjectKey{Name: bundle}})
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(s.Timeout):
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if !s.finished {
+			logger.Info("timed out resyncing bundles of existing volumes", "pending", sets.List(s.pending))
+			s.finished = true
+		}
+	}
+}
+
+// Synced marks the bundle as synced.
+func (s *StartupResync) Synced(bundle string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.started || s.finished {
+		return
+	}
+
+	s.pending.Delete(bundle)
+	s.finished = s.pending.Len() == 0
+}
+
+// ReadyzCheck fails until every bundle has been synced once.
+func (s *StartupResync) ReadyzCheck(*http.Request) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case !s.started:
+		return errors.New("waiting for caches to sync")
+	case !s.finished:
+		return fmt.Errorf("waiting for bundles to be resynced: %s", strings.Join(sets.List(s.pending), ", "))
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+func TestStartupResync(t *testing.T) {
+	s, _ := newState(t, "bundle-a", "bundle-b")
+
+	synced := make(chan struct{})
+	resync := &controller.StartupResync{
+		State: s,
+		WaitForCacheSync: func(context.Context) bool {
+			<-synced
+			return true
+		},
+		Timeout: time.Hour,
+	}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+
+	if err := resync.Source().Start(t.Context(), queue); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := resync.ReadyzCheck(nil); err == nil {
+		t.Fatalf("expected not ready before the caches have synced")
+	}
+
+	close(synced)
+
+	var enqueued []string
+	for range 2 {
+		req, _ := queue.Get()
+		enqueued = append(enqueued, req.Name)
+		queue.Done(req)
+	}
+	slices.Sort(enqueued)
+	if expected := []string{"bundle-a", "bundle-b"}; !slices.Equal(enqueued, expected) {
+		t.Fatalf("expected bundles %v to be enqueued, got %v", expected, enqueued)
+	}
+
+	resync.Synced("bundle-a")
+	if err := resync.ReadyzCheck(nil); err == nil {
+		t.Fatalf("expected not ready while bundle-b is pending")
+	}
+
+	resync.Synced("bundle-b")
+	if err := resync.ReadyzCheck(nil); err != nil {
+		t.Fatalf("expected ready once every bundle is synced, got %s", err)
+	}
+}
+
+func TestStartupResyncTimeout(t *testing.T) {
+	s, _ := newState(t, "bundle-a")
+	resync := &controller.StartupResync{
+		State:            s,
+		WaitForCacheSync: func(context.Context) bool { return true },
+		Timeout:          10 * time.Millisecond,
+	}
+
+	queue := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer queue.ShutDown()
+
+	if err := resync.Source().Start(t.Context(), queue); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for resync.ReadyzCheck(nil) != nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ready after the timeout, got %s", resync.ReadyzCheck(nil))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newState(t *testing.T, bundles ...string) (*state.State, *config.Config) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewState(cfg, encoder)
+	for _, bundle := range bundles {
+		volumeID := "volume-" + bundle
+		if err := os.MkdirAll(cfg.RootPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(metadata.Metadata{VolumeID: volumeID, Bundle: bundle}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s, cfg
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultWatchdogTimeout is how long a single reconcile may take before the
+// controller is considered wedged. A reconcile only reads from the informer
+// cache and writes to the tmpfs, so it normally takes milliseconds.
+const DefaultWatchdogTimeout = 5 * time.Minute
+
+// Watchdog tracks the reconciles in progress, so a controller whose workers
+// are all stuck, and no longer take bundles off the queue, is restarted.
+type Watchdog struct {
+	// Timeout after which a reconcile is considered stuck
+	Timeout time.Duration
+	// Now returns the current time
+	Now func() time.Time
+
+	mu         sync.Mutex
+	next       uint64
+	inProgress map[uint64]inProgressReconcile
+}
+
+type inProgressReconcile struct {
+	bundle  string
+	started time.Time
+}
+
+// Start records the start of a reconcile of the bundle, the returned function
+// must be called once the reconcile has finished.
+func (w *Watchdog) Start(bundle string) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.inProgress == nil {
+		w.inProgress = make(map[uint64]inProgressReconcile)
+	}
+
+	id := w.next
+	w.next++
+	w.inProgress[id] = inProgressReconcile{bundle: bundle, started: w.Now()}
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.inProgress, id)
+	}
+}
+
+// HealthzCheck fails if a reconcile has been in progress for longer than the
+// timeout.
+func (w *Watchdog) HealthzCheck(*http.Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.Now()
+	for _, reconcile := range w.inProgress {
+		if took := now.Sub(reconcile.started); took > w.Timeout {
+			return fmt.Errorf("reconcile of bundle %q stuck for %s", reconcile.bundle, took.Round(time.Second))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+)
+
+func TestWatchdog(t *testing.T) {
+	now := time.Now()
+	watchdog := &controller.Watchdog{
+		Timeout: time.Minute,
+		Now:     func() time.Time { return now },
+	}
+
+	if err := watchdog.HealthzCheck(nil); err != nil {
+		t.Fatalf("expected healthy without reconciles, got %s", err)
+	}
+
+	doneA := watchdog.Start("bundle-a")
+	now = now.Add(30 * time.Second)
+	doneB := watchdog.Start("bundle-b")
+	now = now.Add(time.Minute)
+
+	if err := watchdog.HealthzCheck(nil); err == nil {
+		t.Fatalf("expected error while bundle-a is stuck")
+	}
+
+	doneA()
+	if err := watchdog.HealthzCheck(nil); err != nil {
+		t.Fatalf("expected healthy once bundle-a is done, got %s", err)
+	}
+
+	now = now.Add(time.Minute)
+	if err := watchdog.HealthzCheck(nil); err == nil {
+		t.Fatalf("expected error while bundle-b is stuck")
+	}
+
+	doneB()
+	if err := watchdog.HealthzCheck(nil); err != nil {
+		t.Fatalf("expected healthy once every reconcile is done, got %s", err)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package debug serves the volumes tracked by the driver and their sync status
+// as JSON, so a node can be debugged without reading the metadata files in the
+// tmpfs by hand.
+package debug
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+// Path is the path of the debug endpoint. It is served by its own server on
+// --debug-bind-address, which also exposes /metrics.
+const Path = "/debug/volumes"
+
+// VolumeList is the response of the debug endpoint
+type VolumeList struct {
+	Volumes []Volume `json:"volumes"`
+}
+
+// Volume is a volume tracked by the driver
+type Volume struct {
+	VolumeID          string   `json:"volumeID"`
+	PodNamespace      string   `json:"podNamespace"`
+	PodName           string   `json:"podName,omitempty"`
+	PodUID            string   `json:"podUID,omitempty"`
+	PodServiceAccount string   `json:"podServiceAccount,omitempty"`
+	Bundle            string   `json:"bundle"`
+	Outputs           []Output `json:"outputs"`
+	Status            Status   `json:"status"`
+}
+
+// Output is a file or directory the bundle is written to
+type Output struct {
+	Format string `json:"format"`
+	Path   string `json:"path"`
+	UID    *int64 `json:"uid,omitempty"`
+	GID    *int64 `json:"gid,omitempty"`
+	Mode   *int32 `json:"mode,omitempty"`
+}
+
+// Status is the result of the last sync of a volume
+type Status struct {
+	LastAttempt  time.Time `json:"lastAttempt,omitzero"`
+	LastSuccess  time.Time `json:"lastSuccess,omitzero"`
+	LastError    string    `json:"lastError,omitempty"`
+	FailingSince time.Time `json:"failingSince,omitzero"`
+	Stale        bool      `json:"stale"`
+	Hash         string    `json:"hash,omitempty"`
+	Certificates int       `json:"certificates"`
+	NotAfter     time.Time `json:"notAfter,omitzero"`
+}
+
+// NewVolumeList converts the volumes in the state to the debug representation.
+func NewVolumeList(statuses []state.VolumeStatusWithMetadata) VolumeList {
+	list := VolumeList{Volumes: make([]Volume, 0, len(statuses))}
+	for _, s := range statuses {
+		list.Volumes = append(list.Volumes, newVolume(s.Metadata, s.Status))
+	}
+	return list
+}
+
+func newVolume(meta metadata.Metadata, status state.VolumeStatus) Volume {
+	outputs := make([]Output, 0, len(meta.Outputs))
+	for _, output := range meta.Outputs {
+		outputs = append(outputs, Output{
+			Format: string(output.Format),
+			Path:   output.Path,
+			UID:    output.UID,
+			GID:    output.GID,
+			Mode:   output.Mode,
+		})
+	}
+
+	return Volume{
+		VolumeID:          meta.VolumeID,
+		PodNamespace:      meta.PodNamespace,
+		PodName:           meta.PodName,
+		PodUID:            meta.PodUID,
+		PodServiceAccount: meta.PodServiceAccount,
+		Bundle:            meta.Bundle,
+		Outputs:           outputs,
+		Status: Status{
+			LastAttempt:  status.LastAttempt,
+			LastSuccess:  status.LastSuccess,
+			LastError:    status.LastError,
+			FailingSince: status.FailingSince,
+			Stale:        status.Stale(),
+			Hash:         status.Hash,
+			Certificates: status.Certificates,
+			NotAfter:     status.NotAfter,
+		},
+	}
+}
+
+// Handler serves the volumes in the state as a VolumeList.
+func Handler(s *state.State) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(NewVolumeList(s.Statuses()))
+	})
+}
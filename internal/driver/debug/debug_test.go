@@ -0,0 +1,93 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/debug"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+func TestList(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	for _, volumeID := range []string{"volume-b", "volume-a"} {
+		if err := os.MkdirAll(cfg.RootPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(metadata.Metadata{
+			VolumeID:     volumeID,
+			PodNamespace: "default",
+			PodName:      "pod-" + volumeID,
+			Bundle:       "bundle",
+			Outputs:      []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "ca.crt"}},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SetSynced("volume-a", bundlewriter.SyncResult{Hash: "abc", Certificates: 2}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSyncFailed("volume-b", errors.New("bundle not found"))
+
+	handler := debug.Handler(s)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("expected the token to be sent, got Authorization %q", auth)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	list, err := debug.List(t.Context(), server.Client(), server.URL, "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(list.Volumes) != 2 {
+		t.Fatalf("expected 2 volumes, got %d", len(list.Volumes))
+	}
+
+	a, b := list.Volumes[0], list.Volumes[1]
+	if a.VolumeID != "volume-a" || a.PodName != "pod-volume-a" || a.Bundle != "bundle" || a.PodNamespace != "default" {
+		t.Errorf("unexpected volume: %+v", a)
+	}
+	if len(a.Outputs) != 1 || a.Outputs[0].Path != "ca.crt" || a.Outputs[0].Format != string(metadata.OutputFormatConcatenatedFile) {
+		t.Errorf("unexpected outputs: %+v", a.Outputs)
+	}
+	if a.Status.Hash != "abc" || a.Status.Certificates != 2 || a.Status.Stale || a.Status.LastSuccess.IsZero() {
+		t.Errorf("unexpected status of synced volume: %+v", a.Status)
+	}
+	if b.VolumeID != "volume-b" || !b.Status.Stale || b.Status.LastError != "bundle not found" || b.Status.FailingSince.IsZero() {
+		t.Errorf("unexpected status of failed volume: %+v", b.Status)
+	}
+}
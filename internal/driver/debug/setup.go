@@ -0,0 +1,59 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package debug
+
+import (
+	"fmt"
+	"net/http"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/metrics/filters"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+// Setup serves the debug endpoint on its own server, so clients of the debug
+// endpoint must authenticate without requiring the same of metrics scrapers.
+// Requests are authenticated with TokenReviews and authorized with
+// SubjectAccessReviews for the non-resource URL of the endpoint, granted with
+// a ClusterRole rule like:
+//
+//	nonResourceURLs: ["/debug/volumes"], verbs: ["get"]
+func Setup(mgr ctrl.Manager, config *config.Config, state *state.State) error {
+	options := metricsserver.Options{
+		BindAddress:   config.DebugAddress,
+		SecureServing: !config.InsecureDebugEndpoint,
+		ExtraHandlers: map[string]http.Handler{Path: Handler(state)},
+	}
+	if !config.InsecureDebugEndpoint {
+		options.FilterProvider = filters.WithAuthenticationAndAuthorization
+	}
+
+	server, err := metricsserver.NewServer(options, mgr.GetConfig(), mgr.GetHTTPClient())
+	if err != nil {
+		return fmt.Errorf("could not create debug server: %w", err)
+	}
+
+	// The server is nil if the debug endpoint is disabled
+	if server == nil {
+		return nil
+	}
+
+	return mgr.Add(server)
+}
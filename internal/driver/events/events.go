@@ -0,0 +1,67 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package events records Kubernetes Events on the Pods a volume is mounted
+// into, so application teams can see what happened to their trust bundle
+// without access to the driver logs.
+package events
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientevents "k8s.io/client-go/tools/events"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+)
+
+const (
+	// ReasonTrustBundleUpdated is recorded when the certificates in a volume
+	// changed
+	ReasonTrustBundleUpdated = "TrustBundleUpdated"
+	// ReasonTrustBundleSyncFailed is recorded when a volume could not be
+	// written
+	ReasonTrustBundleSyncFailed = "TrustBundleSyncFailed"
+	// ReasonTrustBundleAccessDenied is recorded when the policy does not allow
+	// the Bundle to be mounted in the namespace of the Pod
+	ReasonTrustBundleAccessDenied = "TrustBundleAccessDenied"
+)
+
+const (
+	// ActionPublishVolume is the action of events recorded when a volume is
+	// published
+	ActionPublishVolume = "PublishVolume"
+	// ActionSyncVolume is the action of events recorded when the Bundle is
+	// written to a volume
+	ActionSyncVolume = "SyncVolume"
+)
+
+// Eventf records an event on the Pod the volume is mounted into. Volumes
+// without a Pod name, i.e. published before the pod info was stored, are
+// ignored, as is a nil recorder.
+func Eventf(recorder clientevents.EventRecorder, meta metadata.Metadata, eventType, reason, action, noteFmt string, args ...any) {
+	if recorder == nil || meta.PodName == "" {
+		return
+	}
+
+	pod := &corev1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       "Pod",
+		Namespace:  meta.PodNamespace,
+		Name:       meta.PodName,
+		UID:        types.UID(meta.PodUID),
+	}
+	recorder.Eventf(pod, nil, eventType, reason, action, noteFmt, args...)
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gc garbage collects volumes left behind in the tmpfs mount.
+//
+// Volumes are normally cleaned up by NodeUnpublishVolume, but if the driver
+// crashes between stopping the sync and removing the volume directory, or
+// kubelet gives up on a volume, the directory and its metadata are left
+// behind forever.
+package gc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/mount-utils"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+const (
+	// MinAge is how long a volume directory must exist before it can be
+	// collected, so volumes that are still being published are not removed
+	// before they are mounted.
+	MinAge = 5 * time.Minute
+
+	// DefaultMountInfoPath is the mountinfo file of the driver's mount
+	// namespace.
+	DefaultMountInfoPath = "/proc/self/mountinfo"
+
+	reasonNotMounted       = "not_mounted"
+	reasonMissingDirectory = "missing_directory"
+	reasonQuarantined      = "quarantined"
+)
+
+var (
+	collectedVolumes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_gc_collected_volumes_total",
+		Help: "Number of orphaned volumes removed by the garbage collector.",
+	}, []string{"reason"})
+
+	collectedStoreEntries = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_gc_collected_store_entries_total",
+		Help: "Number of shared store entries no longer used by any volume removed by the garbage collector.",
+	})
+
+	collectionErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_gc_errors_total",
+		Help: "Number of errors encountered by the garbage collector.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(collectedVolumes, collectedStoreEntries, collectionErrors)
+}
+
+// Collector periodically removes volumes that are no longer mounted by
+// kubelet.
+type Collector struct {
+	Config *config.Config
+	State  *state.State
+	// StoreLock is held while removing shared store entries, the shared
+	// writer holds a read lock until the entry it looked up is linked
+	StoreLock *sync.RWMutex
+
+	// Interval between collections
+	Interval time.Duration
+	// MountInfoPath is the mountinfo file listing the mounts of the node
+	MountInfoPath string
+	// Now returns the current time
+	Now func() time.Time
+}
+
+// Start runs the collector until the context is canceled.
+func (c *Collector) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("gc")
+	ctx = log.IntoContext(ctx, logger)
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.Collect(ctx); err != nil {
+			collectionErrors.Inc()
+			logger.Error(err, "garbage collection failed")
+		}
+	}, c.Interval)
+
+	return nil
+}
+
+// Collect removes the volume directories that are not bind mounted anywhere,
+// and drops volumes from the state whose directory no longer exists.
+func (c *Collector) Collect(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
+	mounted, err := c.mountedVolumes()
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(c.Config.TmpFSPath())
+	if err != nil {
+		return fmt.Errorf("could not list volumes: %w", err)
+	}
+
+	existing := sets.New[string]()
+	for _, entry := range entries {
+		volumeID := entry.Name()
+		if config.IsHidden(volumeID) {
+			continue
+		}
+		existing.Insert(volumeID)
+
+		if mounted.Has(volumeID) || !c.oldEnough(logger, entry) {
+			continue
+		}
+
+		c.collectVolume(logger, volumeID)
+	}
+
+	// Quarantined volumes are not synced, they are only kept around until the
+	// Pod using them is gone
+	quarantined, err := os.ReadDir(c.Config.QuarantinePath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not list quarantined volumes: %w", err)
+	}
+	for _, entry := range quarantined {
+		name := path.Join(config.QuarantineDirName, entry.Name())
+		if mounted.Has(name) || !c.oldEnough(logger, entry) {
+			continue
+		}
+
+		logger.Info("removing quarantined volume that is not mounted", "volume_id", name)
+		if c.removeAll(logger, name) {
+			collectedVolumes.WithLabelValues(reasonQuarantined).Inc()
+		}
+	}
+
+	if err := c.collectStore(logger); err != nil {
+		return err
+	}
+
+	// Volumes in the state without a directory were removed, but the driver
+	// failed before dropping them from the state
+	for _, volumeID := range c.State.VolumeIDs() {
+		if existing.Has(volumeID) {
+			continue
+		}
+
+		c.collectMissingVolume(logger, volumeID)
+	}
+
+	return nil
+}
+
+// collectMissingVolume drops the volume without a directory from the state. The
+// volume may have been published since the directories were listed, so the
+// directory is checked again while the volume is locked.
+func (c *Collector) collectMissingVolume(logger logr.Logger, volumeID string) {
+	defer c.State.LockVolume(volumeID)()
+
+	if _, exists := c.State.GetMetadata(volumeID); !exists {
+		return
+	}
+	if _, err := os.Stat(c.Config.RootPathForVolume(volumeID)); !os.IsNotExist(err) {
+		return
+	}
+
+	c.volumeLogger(logger, volumeID).Info("removing volume without directory from state")
+	_ = c.State.StopSync(volumeID)
+	c.State.Untrack(volumeID)
+	collectedVolumes.WithLabelValues(reasonMissingDirectory).Inc()
+}
+
+// collectVolume removes the volume that is not mounted, the volume is locked
+// so it is not removed while being published or synced. The volume may have
+// been published since the mounts were read, so they are read again while the
+// volume is locked.
+func (c *Collector) collectVolume(logger logr.Logger, volumeID string) {
+	defer c.State.LockVolume(volumeID)()
+
+	mounted, err := c.mountedVolumes()
+	if err != nil {
+		collectionErrors.Inc()
+		logger.Error(err, "could not check whether volume is mounted", "volume_id", volumeID)
+		return
+	}
+	if mounted.Has(volumeID) {
+		return
+	}
+
+	c.volumeLogger(logger, volumeID).Info("removing volume that is not mounted")
+	_ = c.State.StopSync(volumeID)
+	if c.removeAll(logger, volumeID) {
+		c.State.Untrack(volumeID)
+		collectedVolumes.WithLabelValues(reasonNotMounted).Inc()
+	}
+}
+
+// collectStore removes the entries of the shared store no volume was last
+// synced with. Volumes keep the files they link to, removing an entry only
+// stops it from being shared with new volumes.
+func (c *Collector) collectStore(logger logr.Logger) error {
+	if c.StoreLock != nil {
+		c.StoreLock.Lock()
+		defer c.StoreLock.Unlock()
+	}
+
+	entries, err := os.ReadDir(c.Config.StorePath())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not list store entries: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	inUse := sets.New[string]()
+	for _, status := range c.State.Statuses() {
+		inUse.Insert(status.Status.Hash)
+	}
+
+	for _, entry := range entries {
+		if inUse.Has(entry.Name()) || !c.oldEnough(logger, entry) {
+			continue
+		}
+
+		logger.V(2).Info("removing unused store entry", "entry", entry.Name())
+		if err := os.RemoveAll(filepath.Join(c.Config.StorePath(), entry.Name())); err != nil {
+			collectionErrors.Inc()
+			logger.Error(err, "could not remove store entry", "entry", entry.Name())
+			continue
+		}
+		collectedStoreEntries.Inc()
+	}
+
+	return nil
+}
+
+// volumeLogger adds the volume and the pod it is mounted into to the logger.
+func (c *Collector) volumeLogger(logger logr.Logger, volumeID string) logr.Logger {
+	logger = logger.WithValues("volume_id", volumeID)
+	if meta, exists := c.State.GetMetadata(volumeID); exists {
+		logger = logger.WithValues(meta.PodKeysAndValues()...)
+	}
+	return logger
+}
+
+// oldEnough returns whether the directory is older than MinAge.
+func (c *Collector) oldEnough(logger logr.Logger, entry os.DirEntry) bool {
+	info, err := entry.Info()
+	if err != nil {
+		collectionErrors.Inc()
+		logger.Error(err, "could not stat volume directory", "volume_id", entry.Name())
+		return false
+	}
+
+	return c.Now().Sub(info.ModTime()) >= MinAge
+}
+
+// removeAll removes the volume directory, the name is relative to the tmpfs
+// mount.
+func (c *Collector) removeAll(logger logr.Logger, name string) bool {
+	if err := os.RemoveAll(c.Config.RootPathForVolume(name)); err != nil {
+		collectionErrors.Inc()
+		logger.Error(err, "could not remove volume directory", "volume_id", name)
+		return false
+	}
+
+	return true
+}
+
+// mountedVolumes returns the directories in the tmpfs mount of the volumes
+// that are bind mounted. The bind mounts share the device of the tmpfs mount,
+// with the root of the mount being the data directory of the volume, e.g.
+// /<volume-id>/data, or /.quarantine/<name>/data once quarantined.
+func (c *Collector) mountedVolumes() (sets.Set[string], error) {
+	infos, err := mount.ParseMountInfo(c.MountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read mounts: %w", err)
+	}
+
+	tmpFSPath, err := filepath.Abs(c.Config.TmpFSPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var tmpFS *mount.MountInfo
+	for i := range infos {
+		if infos[i].MountPoint == tmpFSPath {
+			tmpFS = &infos[i]
+		}
+	}
+
+	// Without the tmpfs mount we can't tell which volumes are in use, so
+	// nothing can be collected
+	if tmpFS == nil {
+		return nil, fmt.Errorf("tmpfs mount %q not found", tmpFSPath)
+	}
+
+	volumes := sets.New[string]()
+	for _, info := range infos {
+		if info.Major != tmpFS.Major || info.Minor != tmpFS.Minor || info.ID == tmpFS.ID {
+			continue
+		}
+
+		if name := strings.TrimPrefix(path.Dir(info.Root), "/"); name != "" {
+			volumes.Insert(name)
+		}
+	}
+
+	return volumes, nil
+}
@@ -0,0 +1,454 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/mount-utils"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/gc"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/server"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+func TestCollect(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	now := time.Now()
+	old := now.Add(-2 * gc.MinAge)
+
+	// mounted: bind mounted into a pod, must be kept
+	// orphaned: not mounted, must be removed
+	// publishing: not mounted yet but recently created, must be kept
+	// missing: tracked without a directory, must be dropped from the state
+	for _, volumeID := range []string{"mounted", "orphaned", "publishing", "missing"} {
+		if err := os.MkdirAll(cfg.DataPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(metadata.Metadata{VolumeID: volumeID, Bundle: "bundle"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(cfg.RootPathForVolume(volumeID), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Quarantined volumes are removed once they are no longer mounted
+	for _, name := range []string{"quarantined-mounted-1", "quarantined-orphaned-1"} {
+		dir := filepath.Join(cfg.QuarantinePath(), name, "data")
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(filepath.Dir(dir), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := os.Chtimes(cfg.RootPathForVolume("publishing"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.RemoveAll(cfg.RootPathForVolume("missing")); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpFSPath, err := filepath.Abs(cfg.TmpFSPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	mounts := fmt.Sprintf(`22 1 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:12 - proc proc rw
+100 22 0:55 / %[1]s rw,relatime shared:50 - tmpfs tmpfs rw
+101 22 0:56 / /var/lib/kubelet/pods/abc/volumes/kubernetes.io~secret/token rw,relatime shared:51 - tmpfs tmpfs rw
+102 22 0:55 /mounted/data /var/lib/kubelet/pods/abc/volumes/kubernetes.io~csi/trust/mount ro,relatime shared:50 - tmpfs tmpfs rw
+103 22 0:55 /.quarantine/quarantined-mounted-1/data /var/lib/kubelet/pods/def/volumes/kubernetes.io~csi/trust/mount ro,relatime shared:50 - tmpfs tmpfs rw
+`, tmpFSPath)
+	if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &gc.Collector{
+		Config:        cfg,
+		State:         s,
+		MountInfoPath: mountInfo,
+		Now:           func() time.Time { return now },
+	}
+
+	if err := collector.Collect(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	ids := s.VolumeIDs()
+	slices.Sort(ids)
+	if expected := []string{"mounted", "publishing"}; !slices.Equal(ids, expected) {
+		t.Errorf("expected volumes %v in state, got %v", expected, ids)
+	}
+
+	for volumeID, expectExists := range map[string]bool{"mounted": true, "publishing": true, "orphaned": false} {
+		_, err := os.Stat(cfg.RootPathForVolume(volumeID))
+		if exists := err == nil; exists != expectExists {
+			t.Errorf("volume %q: expected directory to exist %t, got %t", volumeID, expectExists, exists)
+		}
+	}
+
+	quarantined, err := s.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"quarantined-mounted-1"}; !slices.Equal(quarantined, expected) {
+		t.Errorf("expected quarantined volumes %v, got %v", expected, quarantined)
+	}
+}
+
+func TestCollectStore(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	now := time.Now()
+	old := now.Add(-2 * gc.MinAge)
+
+	if err := os.MkdirAll(cfg.DataPathForVolume("volume"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Track(metadata.Metadata{VolumeID: "volume", Bundle: "bundle"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetSynced("volume", bundlewriter.SyncResult{Hash: "in-use"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// in-use: a volume was last synced with it, must be kept
+	// unused: no volume was synced with it, must be removed
+	// new: recently created for a volume being synced, must be kept
+	// .tmp-leftover: left behind by a failed write, must be removed
+	for _, name := range []string{"in-use", "unused", "new", ".tmp-leftover"} {
+		dir := filepath.Join(cfg.StorePath(), name)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		if name == "new" {
+			continue
+		}
+		if err := os.Chtimes(dir, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tmpFSPath, err := filepath.Abs(cfg.TmpFSPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	mounts := fmt.Sprintf(`100 22 0:55 / %[1]s rw,relatime shared:50 - tmpfs tmpfs rw
+102 22 0:55 /volume/data /var/lib/kubelet/pods/abc/volumes/kubernetes.io~csi/trust/mount ro,relatime shared:50 - tmpfs tmpfs rw
+`, tmpFSPath)
+	if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &gc.Collector{
+		Config:        cfg,
+		State:         s,
+		MountInfoPath: mountInfo,
+		Now:           func() time.Time { return now },
+	}
+
+	if err := collector.Collect(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	entries, err := os.ReadDir(cfg.StorePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if expected := []string{"in-use", "new"}; !slices.Equal(names, expected) {
+		t.Errorf("expected store entries %v, got %v", expected, names)
+	}
+}
+
+// TestCollectStoreDuringWrite checks store entries are not removed while the
+// shared writer links an entry into a volume.
+func TestCollectStoreDuringWrite(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	now := time.Now()
+	old := now.Add(-2 * gc.MinAge)
+
+	// An old entry no volume was synced with, being linked into a new volume
+	entry := filepath.Join(cfg.StorePath(), "linking")
+	if err := os.MkdirAll(entry, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(entry, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpFSPath, err := filepath.Abs(cfg.TmpFSPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	mounts := fmt.Sprintf("100 22 0:55 / %s rw,relatime shared:50 - tmpfs tmpfs rw\n", tmpFSPath)
+	if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	storeLock := new(sync.RWMutex)
+	collector := &gc.Collector{
+		Config:        cfg,
+		State:         s,
+		StoreLock:     storeLock,
+		MountInfoPath: mountInfo,
+		Now:           func() time.Time { return now },
+	}
+
+	// The shared writer holds a read lock until the entry is linked
+	storeLock.RLock()
+
+	done := make(chan error)
+	go func() {
+		done <- collector.Collect(t.Context())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("expected the collection to wait for the write, got %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if _, err := os.Stat(entry); err != nil {
+		t.Fatalf("expected the entry to be kept while linked: %s", err)
+	}
+
+	storeLock.RUnlock()
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := os.Stat(entry); !os.IsNotExist(err) {
+		t.Fatalf("expected the unused entry to be removed after the write, got %v", err)
+	}
+}
+
+type staticLoader []byte
+
+func (l staticLoader) Load(context.Context, string, string) ([]byte, error) {
+	return l, nil
+}
+
+// TestCollectWhilePublishing publishes a volume after the collector listed the
+// volume directories, the new volume must not be dropped from the state.
+func TestCollectWhilePublishing(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	bundle, err := os.ReadFile("../../utils/x509/testdata/002c0b4f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &server.NodeServer{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(staticLoader(bundle), bundlewriter.NewAtomicFileWriter()),
+		Policy:       policy.AllowAll,
+		Mounter:      mount.NewFakeMounter(nil),
+	}
+
+	// A volume being published, so the collector checks the age of a directory
+	// after listing them
+	if err := os.MkdirAll(cfg.DataPathForVolume("publishing"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpFSPath, err := filepath.Abs(cfg.TmpFSPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	mounts := fmt.Sprintf("100 22 0:55 / %s rw,relatime shared:50 - tmpfs tmpfs rw\n", tmpFSPath)
+	if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	targetPath := filepath.Join(t.TempDir(), "target")
+	if err := os.MkdirAll(targetPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	var publish sync.Once
+	collector := &gc.Collector{
+		Config:        cfg,
+		State:         s,
+		MountInfoPath: mountInfo,
+		Now: func() time.Time {
+			publish.Do(func() {
+				_, err := n.NodePublishVolume(t.Context(), &csi.NodePublishVolumeRequest{
+					VolumeId:   "published",
+					TargetPath: targetPath,
+					Readonly:   true,
+					VolumeContext: map[string]string{
+						"csi.storage.k8s.io/ephemeral":     "true",
+						"csi.storage.k8s.io/pod.namespace": "namespace",
+						"csi.storage.k8s.io/pod.name":      "pod",
+						"csi.storage.k8s.io/pod.uid":       "uid",
+						attributes.BundleKey:               "bundle",
+						attributes.ConcatenatedFilesKey:    "/ca.crt",
+					},
+				})
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+			})
+			return time.Now()
+		},
+	}
+
+	if err := collector.Collect(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, synced := s.GetSyncedMetadata("published"); !synced {
+		t.Errorf("expected the volume published during the collection to be kept in the state")
+	}
+}
+
+// TestCollectMountedWhileCollecting mounts a volume after the collector read
+// the mounts, the volume must not be removed.
+func TestCollectMountedWhileCollecting(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	now := time.Now()
+	old := now.Add(-2 * gc.MinAge)
+
+	if err := os.MkdirAll(cfg.DataPathForVolume("volume"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Track(metadata.Metadata{VolumeID: "volume", Bundle: "bundle"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(cfg.RootPathForVolume("volume"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpFSPath, err := filepath.Abs(cfg.TmpFSPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	mounts := fmt.Sprintf("100 22 0:55 / %s rw,relatime shared:50 - tmpfs tmpfs rw\n", tmpFSPath)
+	if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var remount sync.Once
+	collector := &gc.Collector{
+		Config:        cfg,
+		State:         s,
+		MountInfoPath: mountInfo,
+		Now: func() time.Time {
+			remount.Do(func() {
+				mounts += "102 22 0:55 /volume/data /var/lib/kubelet/pods/abc/volumes/kubernetes.io~csi/trust/mount ro,relatime shared:50 - tmpfs tmpfs rw\n"
+				if err := os.WriteFile(mountInfo, []byte(mounts), 0600); err != nil {
+					t.Error(err)
+				}
+			})
+			return now
+		},
+	}
+
+	if err := collector.Collect(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, exists := s.GetMetadata("volume"); !exists {
+		t.Errorf("expected the volume mounted during the collection to be kept in the state")
+	}
+	if _, err := os.Stat(cfg.DataPathForVolume("volume")); err != nil {
+		t.Errorf("expected the volume mounted during the collection to be kept: %s", err)
+	}
+}
+
+func TestCollectWithoutTmpFS(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	mountInfo := filepath.Join(t.TempDir(), "mountinfo")
+	if err := os.WriteFile(mountInfo, []byte("22 1 0:21 / /proc rw - proc proc rw\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	collector := &gc.Collector{
+		Config:        cfg,
+		MountInfoPath: mountInfo,
+		Now:           time.Now,
+	}
+
+	// Without the tmpfs mount every volume would look orphaned, so nothing
+	// must be collected
+	if err := collector.Collect(t.Context()); err == nil {
+		t.Fatalf("expected error when the tmpfs mount is missing")
+	}
+}
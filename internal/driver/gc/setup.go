@@ -0,0 +1,43 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gc
+
+import (
+	"sync"
+	"time"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+)
+
+func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, storeLock *sync.RWMutex) error {
+	// Garbage collection is disabled
+	if config.GCInterval <= 0 {
+		return nil
+	}
+
+	return mgr.Add(&Collector{
+		Config:        config,
+		State:         state,
+		StoreLock:     storeLock,
+		Interval:      config.GCInterval,
+		MountInfoPath: DefaultMountInfoPath,
+		Now:           time.Now,
+	})
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package health contains the readiness and liveness checks of the driver.
+//
+// Readiness checks fail while the driver can't publish volumes yet, e.g. the
+// informer caches have not synced, liveness checks fail when the driver is
+// broken in a way only a restart fixes, e.g. the tmpfs is no longer writable.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"k8s.io/mount-utils"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+)
+
+// Timeout of checks that wait on something, such as the caches syncing or a
+// dial, so a probe never hangs
+const Timeout = time.Second
+
+// TmpFS checks the tmpfs the volumes are stored in is mounted and writable.
+type TmpFS struct {
+	// Path of the tmpfs mount
+	Path string
+	// Mounter checks whether the path is a mount point
+	Mounter mount.Interface
+}
+
+// Check implements healthz.Checker.
+func (t TmpFS) Check(*http.Request) error {
+	isMnt, err := t.Mounter.IsMountPoint(t.Path)
+	if err != nil {
+		return fmt.Errorf("could not check tmpfs mount %q: %w", t.Path, err)
+	}
+	if !isMnt {
+		return fmt.Errorf("tmpfs %q is not mounted", t.Path)
+	}
+
+	// The file is hidden, so it is never mistaken for a volume
+	file, err := os.CreateTemp(t.Path, ".healthz-*")
+	if err != nil {
+		return fmt.Errorf("tmpfs %q is not writable: %w", t.Path, err)
+	}
+	_ = file.Close()
+	_ = os.Remove(file.Name())
+
+	return nil
+}
+
+// CacheSynced returns a check that fails until the informer caches have
+// synced. Until then Bundles, ConfigMaps and Secrets would appear to be
+// missing, failing every publish.
+func CacheSynced(waitForCacheSync func(context.Context) bool) healthz.Checker {
+	return func(req *http.Request) error {
+		ctx, cancel := context.WithTimeout(req.Context(), Timeout)
+		defer cancel()
+
+		if !waitForCacheSync(ctx) {
+			return errors.New("informer caches have not synced")
+		}
+		return nil
+	}
+}
+
+// Listening returns a check that fails unless a connection can be opened to
+// the address, e.g. the gRPC socket kubelet publishes volumes through.
+func Listening(network, address string) healthz.Checker {
+	return func(req *http.Request) error {
+		dialer := net.Dialer{Timeout: Timeout}
+		conn, err := dialer.DialContext(req.Context(), network, address)
+		if err != nil {
+			return fmt.Errorf("not listening on %s %q: %w", network, address, err)
+		}
+		_ = conn.Close()
+		return nil
+	}
+}
+
+// Probe runs the checks, returning an error describing every failed check.
+func Probe(ctx context.Context, checks map[string]healthz.Checker) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "/healthz", nil)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		if err := checks[name](req); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
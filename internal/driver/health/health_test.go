@@ -0,0 +1,128 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package health_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"k8s.io/mount-utils"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/health"
+)
+
+func TestTmpFS(t *testing.T) {
+	dir := t.TempDir()
+	mounted := mount.NewFakeMounter([]mount.MountPoint{{Device: "tmpfs", Path: dir, Type: "tmpfs"}})
+
+	if err := (health.TmpFS{Path: dir, Mounter: mounted}).Check(nil); err != nil {
+		t.Errorf("expected mounted tmpfs to be healthy, got %s", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected check to clean up after itself, found %d entries", len(entries))
+	}
+
+	if err := (health.TmpFS{Path: dir, Mounter: mount.NewFakeMounter(nil)}).Check(nil); err == nil {
+		t.Errorf("expected error when the tmpfs is not mounted")
+	}
+
+	missing := filepath.Join(dir, "missing")
+	if err := (health.TmpFS{Path: missing, Mounter: mount.NewFakeMounter(nil)}).Check(nil); err == nil {
+		t.Errorf("expected error when the tmpfs does not exist")
+	}
+}
+
+func TestCacheSynced(t *testing.T) {
+	req := newRequest(t)
+
+	if err := health.CacheSynced(func(context.Context) bool { return true })(req); err != nil {
+		t.Errorf("expected synced cache to be ready, got %s", err)
+	}
+
+	// Waiting for the caches to sync is bounded by the timeout
+	check := health.CacheSynced(func(ctx context.Context) bool {
+		<-ctx.Done()
+		return false
+	})
+	if err := check(req); err == nil {
+		t.Errorf("expected error when the caches have not synced")
+	}
+}
+
+func TestListening(t *testing.T) {
+	req := newRequest(t)
+
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "csi.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	check := health.Listening("unix", listener.Addr().String())
+	if err := check(req); err != nil {
+		t.Errorf("expected listening socket to be ready, got %s", err)
+	}
+
+	_ = listener.Close()
+	if err := check(req); err == nil {
+		t.Errorf("expected error once the socket is closed")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	checks := map[string]healthz.Checker{
+		"ok":     func(*http.Request) error { return nil },
+		"broken": func(*http.Request) error { return errors.New("broken") },
+		"failed": func(*http.Request) error { return errors.New("failed") },
+	}
+
+	err := health.Probe(t.Context(), checks)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if expected := "broken: broken\nfailed: failed"; err.Error() != expected {
+		t.Errorf("expected error %q, got %q", expected, err)
+	}
+
+	delete(checks, "broken")
+	delete(checks, "failed")
+	if err := health.Probe(t.Context(), checks); err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+
+	if err := health.Probe(t.Context(), nil); err != nil {
+		t.Errorf("expected no error without checks, got %s", err)
+	}
+}
+
+func newRequest(t *testing.T) *http.Request {
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "/readyz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package policy controls which namespaces may mount which Bundles.
+//
+// trust-manager replicates a Bundle into every namespace matching its
+// namespace selector, and without a policy any Pod in those namespaces can
+// mount it. The policy is read from a file on startup, when no policy is
+// configured every Bundle may be mounted.
+package policy
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy declares which namespaces may mount which Bundles. A Bundle may be
+// mounted in a namespace if any of the rules match both, so a Bundle that is
+// not matched by any rule can't be mounted at all.
+type Policy struct {
+	Rules []Rule `json:"rules"`
+}
+
+// Rule allows the Bundles to be mounted by Pods in the namespaces. Bundle and
+// namespace names may contain shell patterns, as matched by path.Match, for
+// example "*" matches every name.
+type Rule struct {
+	Bundles    []string `json:"bundles"`
+	Namespaces []string `json:"namespaces"`
+}
+
+// AllowAll is the policy used when no policy is configured.
+var AllowAll = &Policy{
+	Rules: []Rule{{Bundles: []string{"*"}, Namespaces: []string{"*"}}},
+}
+
+// Load reads the policy from the file, an empty file name returns AllowAll.
+func Load(file string) (*Policy, error) {
+	if file == "" {
+		return AllowAll, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy: %w", err)
+	}
+
+	var policy Policy
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %q: %w", file, err)
+	}
+
+	if errs := policy.validate(); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid policy %q: %w", file, errs.ToAggregate())
+	}
+
+	return &policy, nil
+}
+
+// Allowed returns whether Pods in the namespace may mount the bundle. A nil
+// policy allows every bundle, same as AllowAll.
+func (p *Policy) Allowed(namespace, bundle string) bool {
+	if p == nil {
+		return true
+	}
+
+	for _, rule := range p.Rules {
+		if matchAny(rule.Namespaces, namespace) && matchAny(rule.Bundles, bundle) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) validate() field.ErrorList {
+	var errs field.ErrorList
+
+	for i, rule := range p.Rules {
+		fldPath := field.NewPath("rules").Index(i)
+		errs = append(errs, validatePatterns(fldPath.Child("bundles"), rule.Bundles)...)
+		errs = append(errs, validatePatterns(fldPath.Child("namespaces"), rule.Namespaces)...)
+	}
+
+	return errs
+}
+
+func validatePatterns(fldPath *field.Path, patterns []string) field.ErrorList {
+	if len(patterns) == 0 {
+		return field.ErrorList{field.Required(fldPath, "")}
+	}
+
+	var errs field.ErrorList
+	for i, pattern := range patterns {
+		// path.Match only reports malformed patterns when matching, so match
+		// against an empty name to check it.
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, field.Invalid(fldPath.Index(i), pattern, err.Error()))
+		}
+	}
+
+	return errs
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,125 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+)
+
+const testPolicy = `
+rules:
+- bundles: ["public", "public-*"]
+  namespaces: ["*"]
+- bundles: ["team-a-private"]
+  namespaces: ["team-a", "team-a-*"]
+`
+
+func TestAllowed(t *testing.T) {
+	p := loadPolicy(t, testPolicy)
+
+	tests := []struct {
+		Namespace, Bundle string
+		Expect            bool
+	}{
+		{Namespace: "team-a", Bundle: "public", Expect: true},
+		{Namespace: "team-b", Bundle: "public-internal", Expect: true},
+		{Namespace: "team-a", Bundle: "team-a-private", Expect: true},
+		{Namespace: "team-a-staging", Bundle: "team-a-private", Expect: true},
+		{Namespace: "team-b", Bundle: "team-a-private", Expect: false},
+		{Namespace: "team-a", Bundle: "unknown", Expect: false},
+	}
+
+	for _, test := range tests {
+		if allowed := p.Allowed(test.Namespace, test.Bundle); allowed != test.Expect {
+			t.Errorf("Allowed(%q, %q): expected %t, got %t", test.Namespace, test.Bundle, test.Expect, allowed)
+		}
+	}
+
+	if !policy.AllowAll.Allowed("any", "bundle") {
+		t.Errorf("expected AllowAll to allow every bundle")
+	}
+
+	var unset *policy.Policy
+	if !unset.Allowed("any", "bundle") {
+		t.Errorf("expected a nil policy to allow every bundle")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Policy    string
+		ExpectErr string
+	}{
+		{
+			Name:   "valid",
+			Policy: testPolicy,
+		},
+		{
+			Name:      "unknown_field",
+			Policy:    "rules:\n- bundle: public\n",
+			ExpectErr: `unknown field "bundle"`,
+		},
+		{
+			Name:      "missing_namespaces",
+			Policy:    "rules:\n- bundles: [public]\n",
+			ExpectErr: "rules[0].namespaces: Required value",
+		},
+		{
+			Name:      "malformed_pattern",
+			Policy:    "rules:\n- bundles: [\"[public\"]\n  namespaces: [\"*\"]\n",
+			ExpectErr: `rules[0].bundles[0]: Invalid value: "[public"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := policy.Load(writePolicy(t, test.Policy))
+			if test.ExpectErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), test.ExpectErr) {
+				t.Fatalf("expected error containing %q, got %v", test.ExpectErr, err)
+			}
+		})
+	}
+}
+
+func loadPolicy(t *testing.T, data string) *policy.Policy {
+	p, err := policy.Load(writePolicy(t, data))
+	if err != nil {
+		t.Fatalf("failed to load policy: %s", err)
+	}
+	return p
+}
+
+func writePolicy(t *testing.T, data string) string {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
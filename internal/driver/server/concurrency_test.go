@@ -0,0 +1,160 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"k8s.io/mount-utils"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/server"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+type staticLoader []byte
+
+func (l staticLoader) Load(context.Context, string, string) ([]byte, error) {
+	return l, nil
+}
+
+// TestConcurrentVolumeOperations publishes, unpublishes and syncs the same
+// volume concurrently, as happens when kubelet retries calls. Run with the
+// race detector, e.g. make test-race.
+func TestConcurrentVolumeOperations(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	bundle, err := os.ReadFile("../../utils/x509/testdata/002c0b4f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundleWriter := bundlewriter.NewBundleWriter(staticLoader(bundle), bundlewriter.NewAtomicFileWriter())
+	workers := syncpool.New(2)
+	mounter := mount.NewFakeMounter(nil)
+
+	n := &server.NodeServer{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundleWriter,
+		Workers:      workers,
+		Policy:       policy.AllowAll,
+		Mounter:      mounter,
+	}
+	r := &controller.Reconciler{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundleWriter,
+		Workers:      workers,
+	}
+
+	// Kubelet creates the target path before publishing
+	targetPath := filepath.Join(t.TempDir(), "target")
+	if err := os.MkdirAll(targetPath, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	publish := &csi.NodePublishVolumeRequest{
+		VolumeId:   "volume",
+		TargetPath: targetPath,
+		Readonly:   true,
+		VolumeContext: map[string]string{
+			"csi.storage.k8s.io/ephemeral":     "true",
+			"csi.storage.k8s.io/pod.namespace": "namespace",
+			"csi.storage.k8s.io/pod.name":      "pod",
+			"csi.storage.k8s.io/pod.uid":       "uid",
+			attributes.BundleKey:               "bundle",
+			attributes.ConcatenatedFilesKey:    "/ca.crt",
+		},
+	}
+	unpublish := &csi.NodeUnpublishVolumeRequest{VolumeId: "volume", TargetPath: targetPath}
+	reconcile := ctrl.Request{NamespacedName: client.ObjectKey{Name: "bundle"}}
+
+	operations := []func() error{
+		func() error {
+			_, err := n.NodePublishVolume(t.Context(), publish)
+			return err
+		},
+		func() error {
+			_, err := r.Reconcile(t.Context(), reconcile)
+			return err
+		},
+		func() error {
+			_, err := n.NodeUnpublishVolume(t.Context(), unpublish)
+			return err
+		},
+	}
+
+	// Every goroutine runs the operations in a different order, so each
+	// operation overlaps with the others
+	var wg sync.WaitGroup
+	for i := range 6 {
+		wg.Go(func() {
+			for j := range 3 * 20 {
+				if err := operations[(i+j)%len(operations)](); err != nil {
+					t.Errorf("unexpected error: %s", err)
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	// Whatever the order, the volume must end up in a consistent state
+	if _, err := n.NodePublishVolume(t.Context(), publish); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, synced := s.GetSyncedMetadata("volume"); !synced {
+		t.Fatalf("expected the published volume to be synced")
+	}
+	if _, err := os.Stat(filepath.Join(cfg.DataPathForVolume("volume"), "ca.crt")); err != nil {
+		t.Fatalf("expected the published volume to contain the bundle: %s", err)
+	}
+
+	if _, err := n.NodeUnpublishVolume(t.Context(), unpublish); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ids := s.VolumeIDs(); len(ids) != 0 {
+		t.Fatalf("expected no volumes in the state, got %v", ids)
+	}
+	if _, err := os.Stat(cfg.RootPathForVolume("volume")); !os.IsNotExist(err) {
+		t.Fatalf("expected the volume directory to be removed, got %v", err)
+	}
+	if mounts, _ := mounter.List(); len(mounts) != 0 {
+		t.Fatalf("expected no mounts, got %v", mounts)
+	}
+}
@@ -23,11 +23,17 @@ import (
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/types/known/wrapperspb"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/health"
 )
 
 type IdentityServer struct {
 	Name    string
 	Version string
+	// LivenessChecks are run on every Probe, the CSI liveness probe sidecar
+	// restarts the driver when any of them fail
+	LivenessChecks map[string]healthz.Checker
 
 	csi.UnimplementedIdentityServer
 }
@@ -51,6 +57,10 @@ func (i *IdentityServer) GetPluginCapabilities(context.Context, *csi.GetPluginCa
 	return &csi.GetPluginCapabilitiesResponse{}, nil
 }
 
-func (i *IdentityServer) Probe(context.Context, *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+func (i *IdentityServer) Probe(ctx context.Context, _ *csi.ProbeRequest) (*csi.ProbeResponse, error) {
+	if err := health.Probe(ctx, i.LivenessChecks); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
 	return &csi.ProbeResponse{Ready: wrapperspb.Bool(true)}, nil
 }
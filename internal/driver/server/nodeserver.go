@@ -18,39 +18,67 @@ package server
 
 import (
 	"context"
-	"encoding/csv"
 	"fmt"
+	"io/fs"
 	"os"
-	"path"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
+	"time"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientevents "k8s.io/client-go/tools/events"
 	"k8s.io/mount-utils"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/events"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+)
+
+// Keys of the pod info kubelet adds to the volume context, see podInfoOnMount
+// in the CSIDriver.
+const (
+	ephemeralKey          = "csi.storage.k8s.io/ephemeral"
+	podNamespaceKey       = "csi.storage.k8s.io/pod.namespace"
+	podNameKey            = "csi.storage.k8s.io/pod.name"
+	podUIDKey             = "csi.storage.k8s.io/pod.uid"
+	serviceAccountNameKey = "csi.storage.k8s.io/serviceAccount.name"
 )
 
 type NodeServer struct {
 	Config       *config.Config
 	State        *state.State
 	BundleWriter bundlewriter.BundleWriter
+	// Workers bounds the number of volumes synced concurrently, if set
+	Workers *syncpool.Pool
+	// Policy declares which namespaces may mount which Bundles, nil allows
+	// every Bundle
+	Policy   *policy.Policy
+	Recorder clientevents.EventRecorder
 
-	once    sync.Once
-	mounter mount.Interface
+	// Mounter bind mounts the volumes, the system mounter is used if not set
+	Mounter mount.Interface
+
+	once sync.Once
 
 	csi.UnimplementedNodeServer
 }
 
 func (n *NodeServer) setup() {
-	n.mounter = mount.New("")
+	if n.Mounter == nil {
+		n.Mounter = mount.New("")
+	}
 }
 
 func (n *NodeServer) NodeGetCapabilities(ctx context.Context, _ *csi.NodeGetCapabilitiesRequest) (*csi.NodeGetCapabilitiesResponse, error) {
@@ -69,6 +97,22 @@ func (n *NodeServer) NodeGetCapabilities(ctx context.Context, _ *csi.NodeGetCapa
 					},
 				},
 			},
+			// Report the usage of the volumes, and whether the bundle in a
+			// volume is stale because syncing it fails.
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_STATS,
+					},
+				},
+			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_GET_VOLUME_HEALTH,
+					},
+				},
+			},
 		},
 	}, nil
 }
@@ -76,30 +120,28 @@ func (n *NodeServer) NodeGetCapabilities(ctx context.Context, _ *csi.NodeGetCapa
 func (n *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublishVolumeRequest) (_ *csi.NodePublishVolumeResponse, err error) {
 	n.once.Do(n.setup)
 
-	logger := log.FromContext(ctx).WithValues("volume_id", req.GetVolumeId(), "target_path", req.GetTargetPath())
+	volumeContext := req.GetVolumeContext()
+	logger := log.FromContext(ctx).WithValues(
+		"volume_id", req.GetVolumeId(),
+		"target_path", req.GetTargetPath(),
+		"pod_namespace", volumeContext[podNamespaceKey],
+		"pod_name", volumeContext[podNameKey],
+		"pod_uid", volumeContext[podUIDKey],
+		"service_account", volumeContext[serviceAccountNameKey],
+	)
+	ctx = log.IntoContext(ctx, logger)
 	logger.Info("starting volume publish")
 
-	// If the method fails for any reason we want to roll back the changes,
-	// including:
-	// - Removing from the state so the controller does not try and sync it
-	// - Unmounting the bind volume
-	// - Removing the root directory for the volume
-	//
-	// This is essentially what happens inside NodeUnpublishVolume but without
-	// error checking.
-	defer func() {
-		if err != nil {
-			_ = n.State.StopSync(req.GetVolumeId())
-			_ = n.mounter.Unmount(req.GetTargetPath())
-			_ = os.RemoveAll(n.Config.RootPathForVolume(req.GetVolumeId()))
-		}
-	}()
+	// Kubelet retries calls that time out, so the same volume may be
+	// published and unpublished concurrently. The lock is held until the
+	// changes are rolled back on failure.
+	defer n.State.LockVolume(req.GetVolumeId())()
 
 	// Ephemeral volumes are when the volume is defined directly in the Pod spec
 	// instead of in a PVC. This is the only supported method since a PVC makes
 	// no sense for out use case.
-	if req.GetVolumeContext()["csi.storage.k8s.io/ephemeral"] != "true" {
-		return nil, fmt.Errorf("only ephemeral volume types are supported")
+	if volumeContext[ephemeralKey] != "true" {
+		return nil, status.Error(codes.InvalidArgument, "only ephemeral volume types are supported")
 	}
 
 	// We don't want the directory to be writable, we need full control over the
@@ -110,16 +152,26 @@ func (n *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 
 	// trust-manager replicates the ConfigMap/Secret into the Pods namespace, so
 	// we need the Pods namespace to look up the ConfigMap/Secret
-	namespace := req.GetVolumeContext()["csi.storage.k8s.io/pod.namespace"]
+	namespace := volumeContext[podNamespaceKey]
 	if namespace == "" {
 		return nil, fmt.Errorf("namespace is not set in volume context")
 	}
 
-	// trust-manager replicates the ConfigMap/Secret into the Pods namespace, so
-	// we need the Pods namespace to look up the ConfigMap/Secret
-	bundle := req.GetVolumeContext()["trust.cert-manager.io/bundle"]
-	if namespace == "" {
-		return nil, fmt.Errorf("bundle is not set in volume context")
+	// Parse and validate all the trust.cert-manager.io/* attributes at once,
+	// these errors end up as events on the Pod so they need to list every
+	// problem found.
+	attrs, err := attributes.Parse(volumeContext)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid volume attributes: %s", err)
+	}
+
+	// Check the namespace is allowed to mount the bundle before anything is
+	// written to disk
+	if !n.Policy.Allowed(namespace, attrs.Bundle) {
+		pod := metadata.Metadata{PodNamespace: namespace, PodName: volumeContext[podNameKey], PodUID: volumeContext[podUIDKey]}
+		events.Eventf(n.Recorder, pod, corev1.EventTypeWarning, events.ReasonTrustBundleAccessDenied, events.ActionPublishVolume,
+			"Bundle %q may not be mounted in namespace %q by policy", attrs.Bundle, namespace)
+		return nil, status.Errorf(codes.PermissionDenied, "bundle %q may not be mounted in namespace %q by policy", attrs.Bundle, namespace)
 	}
 
 	// Since we specify the VOLUME_MOUNT_GROUP capability the group is passed to
@@ -138,96 +190,154 @@ func (n *NodeServer) NodePublishVolume(ctx context.Context, req *csi.NodePublish
 		gid = &parsedGid
 	}
 
-	files, err := splitList(req.GetVolumeContext()["trust.cert-manager.io/concatenated-files"])
-	if err != nil {
-		return nil, fmt.Errorf("could not parse concatenated-files: %w", err)
-	}
-
-	hashes, err := splitList(req.GetVolumeContext()["trust.cert-manager.io/openssl-rehash"])
-	if err != nil {
-		return nil, fmt.Errorf("could not parse openssl-rehash: %w", err)
-	}
-
 	// Build the metadata object, this needs to contain all the information to
 	// reconcile this mount.
 	meta := metadata.Metadata{
-		VolumeID:     req.GetVolumeId(),
-		PodNamespace: namespace,
-		Bundle:       bundle,
+		VolumeID:          req.GetVolumeId(),
+		PodNamespace:      namespace,
+		PodName:           volumeContext[podNameKey],
+		PodUID:            volumeContext[podUIDKey],
+		PodServiceAccount: volumeContext[serviceAccountNameKey],
+		Bundle:            attrs.Bundle,
+		Outputs:           attrs.Outputs,
+
+		CreationTimestamp: metav1.Now(),
 	}
 
-	for _, p := range files {
-		meta.Outputs = append(meta.Outputs, metadata.Output{
-			Format: metadata.OutputFormatConcatenatedFile,
-			// We use path.Join to clean any leading "../" to prevent path
-			// traversal attacks
-			Path: path.Join("/", p),
-			GID:  gid,
-		})
+	// Outputs without an explicit group are owned by the volume mount group
+	for i := range meta.Outputs {
+		if meta.Outputs[i].GID == nil {
+			meta.Outputs[i].GID = gid
+		}
 	}
 
-	for _, p := range hashes {
-		meta.Outputs = append(meta.Outputs, metadata.Output{
-			Format: metadata.OutputFormatOpenSSLRehash,
-			// We use path.Join to clean any leading "../" to prevent path
-			// traversal attacks
-			Path: path.Join("/", p),
-			GID:  gid,
-		})
-	}
+	// Kubelet retries publishing a volume until it gets a response, so the
+	// volume may already be published. As required by the CSI spec the call
+	// succeeds if the volume was published with the same parameters, without
+	// syncing it again, and fails with ALREADY_EXISTS otherwise.
+	if existing, synced := n.State.GetSyncedMetadata(req.GetVolumeId()); synced {
+		if !samePublishParameters(existing, meta) {
+			return nil, status.Errorf(codes.AlreadyExists, "volume %q is already published with different parameters", req.GetVolumeId())
+		}
 
-	if len(meta.Outputs) == 0 {
-		return nil, fmt.Errorf("no outputs specified")
+		if err := n.bindMount(ctx, req); err != nil {
+			return nil, err
+		}
+
+		logger.Info("volume is already published")
+		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
+	// If the method fails for any reason we want to roll back the changes,
+	// including:
+	// - Removing from the state so the controller does not try and sync it
+	// - Unmounting the bind volume
+	// - Removing the root directory for the volume
+	//
+	// This is essentially what happens inside NodeUnpublishVolume but without
+	// error checking. Nothing is written before this point, so a volume that
+	// was already published is left alone.
+	defer func() {
+		if err != nil {
+			_ = n.State.StopSync(req.GetVolumeId())
+			_ = n.Mounter.Unmount(req.GetTargetPath())
+			if os.RemoveAll(n.Config.RootPathForVolume(req.GetVolumeId())) == nil {
+				n.State.Untrack(req.GetVolumeId())
+			}
+		}
+	}()
+
 	// Create the volume root/data directories, the data directory is what is
 	// bind mounted to req.TargetPath
+	//
+	// The data directory is the root of the volume in the Pod so it needs to
+	// be traversable by any user, access to the files is controlled by the
+	// mode and owner of each output.
 	logger.Info("creating volume root directory")
-	if err := os.MkdirAll(n.Config.DataPathForVolume(req.GetVolumeId()), 0440); err != nil {
+	if err := os.MkdirAll(n.Config.DataPathForVolume(req.GetVolumeId()), 0755); err != nil {
 		return nil, fmt.Errorf("failed to create volume directory: %w", err)
 	}
 
 	// First attempt a sync, we want the data in place before the Pod starts, so
 	// we sync the data before adding to state
 	logger.Info("performing initial volume sync")
-	if err := n.BundleWriter.Sync(ctx, meta, n.Config.DataPathForVolume(req.GetVolumeId())); err != nil {
+	var result bundlewriter.SyncResult
+	if poolErr := n.Workers.Do(ctx, syncpool.PriorityPublish, func() {
+		result, err = n.BundleWriter.Sync(ctx, meta, n.Config.DataPathForVolume(req.GetVolumeId()))
+	}); poolErr != nil {
+		err = poolErr
+	}
+	if err != nil {
+		events.Eventf(n.Recorder, meta, corev1.EventTypeWarning, events.ReasonTrustBundleSyncFailed, events.ActionSyncVolume,
+			"Failed to sync trust bundle %q: %s", meta.Bundle, err)
 		return nil, fmt.Errorf("failed perform initial volume sync: %w", err)
 	}
+	meta.LastSyncedHash = result.Hash
+	meta.LastSyncedCertificates = result.Certificates
 
-	// Create bind mount from our data directory to req.TargetPath
-	isMnt, err := n.mounter.IsMountPoint(req.GetTargetPath())
+	if err := n.bindMount(ctx, req); err != nil {
+		return nil, err
+	}
+
+	// Add to the state so the controller will reconcile changes
+	logger.Info("tracking changes for volume")
+	if err := n.State.Track(meta); err != nil {
+		return nil, fmt.Errorf("failed to add volume to state: %w", err)
+	}
+	if _, err := n.State.SetSynced(meta.VolumeID, result); err != nil {
+		return nil, fmt.Errorf("failed to record initial volume sync: %w", err)
+	}
+
+	logger.Info("volume has been published")
+	return &csi.NodePublishVolumeResponse{}, nil
+}
+
+// bindMount creates the bind mount from the data directory of the volume to
+// the target path, unless it is already mounted.
+func (n *NodeServer) bindMount(ctx context.Context, req *csi.NodePublishVolumeRequest) error {
+	isMnt, err := n.Mounter.IsMountPoint(req.GetTargetPath())
 
 	if os.IsNotExist(err) {
 		err = os.MkdirAll(req.GetTargetPath(), 0440)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to check of path is mount volume: %w", err)
+		return fmt.Errorf("failed to check of path is mount volume: %w", err)
 	}
 
 	if !isMnt {
-		logger.Info("creating bind mount")
-		if err := n.mounter.Mount(n.Config.DataPathForVolume(req.GetVolumeId()), req.GetTargetPath(), "", []string{"bind", "ro"}); err != nil {
-			return nil, err
+		log.FromContext(ctx).Info("creating bind mount")
+		if err := n.Mounter.Mount(n.Config.DataPathForVolume(req.GetVolumeId()), req.GetTargetPath(), "", []string{"bind", "ro"}); err != nil {
+			return err
 		}
 	}
 
-	// Add to the state so the controller will reconcile changes
-	logger.Info("tracking changes for volume")
-	if err := n.State.Track(meta); err != nil {
-		return nil, fmt.Errorf("failed to add volume to state: %w", err)
-	}
+	return nil
+}
 
-	logger.Info("volume has been published")
-	return &csi.NodePublishVolumeResponse{}, nil
+// samePublishParameters returns whether a volume was published with the same
+// parameters, i.e. into the same Pod with the same Bundle and outputs. The pod
+// name and UID are only compared if they are known, volumes loaded from
+// v1alpha1 metadata were published without them.
+func samePublishParameters(existing, requested metadata.Metadata) bool {
+	return existing.PodNamespace == requested.PodNamespace &&
+		(existing.PodName == "" || existing.PodName == requested.PodName) &&
+		(existing.PodUID == "" || existing.PodUID == requested.PodUID) &&
+		existing.Bundle == requested.Bundle &&
+		equality.Semantic.DeepEqual(existing.Outputs, requested.Outputs)
 }
 
 func (n *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpublishVolumeRequest) (*csi.NodeUnpublishVolumeResponse, error) {
 	n.once.Do(n.setup)
 
 	logger := log.FromContext(ctx).WithValues("volume_id", req.GetVolumeId(), "target_path", req.GetTargetPath())
+	if meta, exists := n.State.GetMetadata(req.GetVolumeId()); exists {
+		logger = logger.WithValues(meta.PodKeysAndValues()...)
+	}
 	logger.Info("starting volume unpublish")
 
+	defer n.State.LockVolume(req.GetVolumeId())()
+
 	// Remove the volume from the state, this will stop the controller syncing
 	// the volume while we clean up.
 	logger.Info("stopping sync for volume")
@@ -236,7 +346,7 @@ func (n *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpub
 	}
 
 	// Check if the target path is a mount point
-	isMnt, err := n.mounter.IsMountPoint(req.GetTargetPath())
+	isMnt, err := n.Mounter.IsMountPoint(req.GetTargetPath())
 	if err != nil {
 		return nil, err
 	}
@@ -244,7 +354,7 @@ func (n *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpub
 	// Clean up the bind mount
 	if isMnt {
 		logger.Info("unmounting volume")
-		if err := n.mounter.Unmount(req.GetTargetPath()); err != nil {
+		if err := n.Mounter.Unmount(req.GetTargetPath()); err != nil {
 			return nil, err
 		}
 	}
@@ -257,6 +367,11 @@ func (n *NodeServer) NodeUnpublishVolume(ctx context.Context, req *csi.NodeUnpub
 		return &csi.NodeUnpublishVolumeResponse{}, err
 	}
 
+	// The volume is gone, so it can be dropped from the state. If anything
+	// above failed the volume stays in the state until kubelet retries, or
+	// the garbage collector finds it.
+	n.State.Untrack(req.GetVolumeId())
+
 	logger.Info("volume has been unpublished")
 	return &csi.NodeUnpublishVolumeResponse{}, nil
 }
@@ -269,8 +384,78 @@ func (n *NodeServer) NodeUnstageVolume(context.Context, *csi.NodeUnstageVolumeRe
 	return nil, status.Error(codes.Unimplemented, "NodeUnstageVolume not implemented")
 }
 
-func (n *NodeServer) NodeGetVolumeStats(context.Context, *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "NodeGetVolumeStats not implemented")
+// NodeGetVolumeStats reports the space and inodes used by the volume.
+func (n *NodeServer) NodeGetVolumeStats(_ context.Context, req *csi.NodeGetVolumeStatsRequest) (*csi.NodeGetVolumeStatsResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_id must be set")
+	}
+	if req.GetVolumePath() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_path must be set")
+	}
+
+	if _, exists := n.State.GetMetadata(req.GetVolumeId()); !exists {
+		return nil, status.Errorf(codes.NotFound, "volume %q not found", req.GetVolumeId())
+	}
+
+	bytes, inodes, err := diskUsage(n.Config.DataPathForVolume(req.GetVolumeId()))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "could not get usage of volume %q: %s", req.GetVolumeId(), err)
+	}
+
+	return &csi.NodeGetVolumeStatsResponse{
+		Usage: []*csi.VolumeUsage{
+			{Unit: csi.VolumeUsage_BYTES, Used: bytes},
+			{Unit: csi.VolumeUsage_INODES, Used: inodes},
+		},
+	}, nil
+}
+
+// NodeGetVolumeHealth reports the volume as degraded while syncing the bundle
+// to it fails, in which case it still contains the last successfully synced
+// bundle.
+func (n *NodeServer) NodeGetVolumeHealth(_ context.Context, req *csi.NodeGetVolumeHealthRequest) (*csi.NodeGetVolumeHealthResponse, error) {
+	if req.GetVolumeId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume_id must be set")
+	}
+
+	if _, exists := n.State.GetMetadata(req.GetVolumeId()); !exists {
+		return nil, status.Errorf(codes.NotFound, "volume %q not found", req.GetVolumeId())
+	}
+
+	health := &csi.VolumeHealth{VolumeId: req.GetVolumeId()}
+	if syncStatus := n.State.GetStatus(req.GetVolumeId()); syncStatus.Stale() {
+		health.HealthStatuses = append(health.HealthStatuses, &csi.VolumeHealth_VolumeHealthEntry{
+			Status: csi.VolumeHealthErrorType_DEGRADED,
+			Reason: "TrustBundleStale",
+			Message: fmt.Sprintf("syncing the trust bundle has failed since %s: %s",
+				syncStatus.FailingSince.UTC().Format(time.RFC3339), syncStatus.LastError),
+		})
+	}
+
+	return &csi.NodeGetVolumeHealthResponse{VolumeHealth: health}, nil
+}
+
+// diskUsage returns the size of the files, and the number of files and
+// directories in the directory. Symlinks are not followed.
+func diskUsage(dir string) (bytes int64, inodes int64, err error) {
+	err = filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		inodes++
+		if info.Mode().IsRegular() {
+			bytes += info.Size()
+		}
+		return nil
+	})
+
+	return bytes, inodes, err
 }
 
 func (n *NodeServer) NodeExpandVolume(context.Context, *csi.NodeExpandVolumeRequest) (*csi.NodeExpandVolumeResponse, error) {
@@ -282,9 +467,3 @@ func (n *NodeServer) NodeGetInfo(context.Context, *csi.NodeGetInfoRequest) (*csi
 		NodeId: n.Config.NodeID,
 	}, nil
 }
-
-func splitList(s string) ([]string, error) {
-	cr := csv.NewReader(strings.NewReader(s))
-	cr.TrimLeadingSpace = true
-	return cr.Read()
-}
@@ -0,0 +1,324 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package server_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/mount-utils"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha1"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/server"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+func TestNodeGetVolumeStatsAndHealth(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	data := cfg.DataPathForVolume("volume")
+	if err := os.MkdirAll(filepath.Join(data, "certs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, size := range map[string]int{"ca-certificates.crt": 100, "certs/0a775a30.0": 20} {
+		if err := os.WriteFile(filepath.Join(data, name), make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Track(metadata.Metadata{VolumeID: "volume", Bundle: "bundle"}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &server.NodeServer{Config: cfg, State: s}
+
+	stats, err := n.NodeGetVolumeStats(t.Context(), &csi.NodeGetVolumeStatsRequest{VolumeId: "volume", VolumePath: "/target"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, usage := range stats.GetUsage() {
+		// The data directory, the certs directory and two files
+		expected := map[csi.VolumeUsage_Unit]int64{csi.VolumeUsage_BYTES: 120, csi.VolumeUsage_INODES: 4}[usage.GetUnit()]
+		if usage.GetUsed() != expected {
+			t.Errorf("expected %d %s used, got %d", expected, usage.GetUnit(), usage.GetUsed())
+		}
+	}
+
+	_, err = n.NodeGetVolumeStats(t.Context(), &csi.NodeGetVolumeStatsRequest{VolumeId: "unknown", VolumePath: "/target"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for an unknown volume, got %v", err)
+	}
+
+	health := func() []*csi.VolumeHealth_VolumeHealthEntry {
+		resp, err := n.NodeGetVolumeHealth(t.Context(), &csi.NodeGetVolumeHealthRequest{VolumeId: "volume"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return resp.GetVolumeHealth().GetHealthStatuses()
+	}
+
+	if statuses := health(); len(statuses) != 0 {
+		t.Fatalf("expected a healthy volume, got %v", statuses)
+	}
+
+	s.SetSyncFailed("volume", errors.New("configmap not found"))
+	statuses := health()
+	if len(statuses) != 1 || statuses[0].GetStatus() != csi.VolumeHealthErrorType_DEGRADED || !strings.Contains(statuses[0].GetMessage(), "configmap not found") {
+		t.Fatalf("expected a degraded volume, got %v", statuses)
+	}
+
+	if _, err := s.SetSynced("volume", bundlewriter.SyncResult{Hash: "hash", Certificates: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if statuses := health(); len(statuses) != 0 {
+		t.Fatalf("expected a healthy volume once synced, got %v", statuses)
+	}
+}
+
+type countingWriter struct {
+	bundlewriter.FileWriter
+	writes int
+}
+
+func (w *countingWriter) Write(ctx context.Context, target string, payload map[string]bundlewriter.FileProjection) error {
+	w.writes++
+	return w.FileWriter.Write(ctx, target, payload)
+}
+
+func TestNodePublishVolumeIdempotent(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := state.NewState(cfg, encoder)
+
+	bundle, err := os.ReadFile("../../utils/x509/testdata/002c0b4f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &countingWriter{FileWriter: bundlewriter.NewAtomicFileWriter()}
+	mounter := mount.NewFakeMounter(nil)
+
+	n := &server.NodeServer{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(staticLoader(bundle), writer),
+		Policy:       policy.AllowAll,
+		Mounter:      mounter,
+	}
+
+	targetPath := filepath.Join(t.TempDir(), "target")
+	request := func(mutate func(volumeContext map[string]string)) *csi.NodePublishVolumeRequest {
+		volumeContext := map[string]string{
+			"csi.storage.k8s.io/ephemeral":     "true",
+			"csi.storage.k8s.io/pod.namespace": "namespace",
+			"csi.storage.k8s.io/pod.name":      "pod",
+			"csi.storage.k8s.io/pod.uid":       "uid",
+			attributes.BundleKey:               "bundle",
+			attributes.ConcatenatedFilesKey:    "/ca.crt",
+		}
+		if mutate != nil {
+			mutate(volumeContext)
+		}
+		return &csi.NodePublishVolumeRequest{
+			VolumeId:      "volume",
+			TargetPath:    targetPath,
+			Readonly:      true,
+			VolumeContext: volumeContext,
+		}
+	}
+
+	// checkPublished checks the volume is still published as by the first call
+	checkPublished := func(name string) {
+		meta, synced := s.GetSyncedMetadata("volume")
+		if !synced || meta.Bundle != "bundle" {
+			t.Fatalf("%s: expected the volume to be published with bundle %q, got %+v", name, "bundle", meta)
+		}
+		if _, err := os.Stat(filepath.Join(cfg.DataPathForVolume("volume"), "ca.crt")); err != nil {
+			t.Fatalf("%s: expected the volume to keep its files: %s", name, err)
+		}
+		if mounted, err := mounter.IsMountPoint(targetPath); err != nil || !mounted {
+			t.Fatalf("%s: expected the target to be mounted, got %t, %v", name, mounted, err)
+		}
+		if mounts, _ := mounter.List(); len(mounts) != 1 {
+			t.Fatalf("%s: expected a single mount, got %v", name, mounts)
+		}
+	}
+
+	if _, err := n.NodePublishVolume(t.Context(), request(nil)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkPublished("first publish")
+	published, _ := s.GetMetadata("volume")
+
+	// Publishing again with the same parameters succeeds without writing the
+	// volume again or replacing its metadata
+	if _, err := n.NodePublishVolume(t.Context(), request(nil)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkPublished("same parameters")
+	if writer.writes != 1 {
+		t.Errorf("expected the volume to be written once, got %d writes", writer.writes)
+	}
+	if meta, _ := s.GetMetadata("volume"); !meta.CreationTimestamp.Equal(&published.CreationTimestamp) {
+		t.Errorf("expected the metadata to be kept, got creation timestamp %s instead of %s", meta.CreationTimestamp, published.CreationTimestamp)
+	}
+
+	// A missing bind mount is created again
+	if err := mounter.Unmount(targetPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := n.NodePublishVolume(t.Context(), request(nil)); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkPublished("unmounted")
+
+	tests := []struct {
+		name string
+		req  *csi.NodePublishVolumeRequest
+		code codes.Code
+	}{
+		{
+			name: "different bundle",
+			req:  request(func(volumeContext map[string]string) { volumeContext[attributes.BundleKey] = "other" }),
+			code: codes.AlreadyExists,
+		},
+		{
+			name: "different outputs",
+			req:  request(func(volumeContext map[string]string) { volumeContext[attributes.ConcatenatedFilesKey] = "/other.crt" }),
+			code: codes.AlreadyExists,
+		},
+		{
+			name: "different pod",
+			req:  request(func(volumeContext map[string]string) { volumeContext["csi.storage.k8s.io/pod.uid"] = "other" }),
+			code: codes.AlreadyExists,
+		},
+		{
+			name: "invalid request",
+			req:  request(func(volumeContext map[string]string) { delete(volumeContext, attributes.BundleKey) }),
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, test := range tests {
+		_, err := n.NodePublishVolume(t.Context(), test.req)
+		if status.Code(err) != test.code {
+			t.Errorf("%s: expected %s, got %v", test.name, test.code, err)
+		}
+		checkPublished(test.name)
+	}
+}
+
+// TestNodePublishVolumeAfterUpgrade publishes a volume again after upgrading
+// from a driver storing v1alpha1 metadata, which has no pod name and UID.
+func TestNodePublishVolumeAfterUpgrade(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	oldEncoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha1.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := oldEncoder.Encode(metadata.Metadata{
+		VolumeID:     "volume",
+		PodNamespace: "namespace",
+		Bundle:       "bundle",
+		Outputs:      []metadata.Output{{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(cfg.DataPathForVolume("volume"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cfg.MetadataPathForVolume("volume"), old, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewState(cfg, encoder)
+	if err := s.Load(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, err := os.ReadFile("../../utils/x509/testdata/002c0b4f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := &countingWriter{FileWriter: bundlewriter.NewAtomicFileWriter()}
+
+	// Without a policy every Bundle may be mounted
+	n := &server.NodeServer{
+		Config:       cfg,
+		State:        s,
+		BundleWriter: bundlewriter.NewBundleWriter(staticLoader(bundle), writer),
+		Mounter:      mount.NewFakeMounter(nil),
+	}
+
+	request := func(namespace string) *csi.NodePublishVolumeRequest {
+		return &csi.NodePublishVolumeRequest{
+			VolumeId:   "volume",
+			TargetPath: filepath.Join(t.TempDir(), "target"),
+			Readonly:   true,
+			VolumeContext: map[string]string{
+				"csi.storage.k8s.io/ephemeral":     "true",
+				"csi.storage.k8s.io/pod.namespace": namespace,
+				"csi.storage.k8s.io/pod.name":      "pod",
+				"csi.storage.k8s.io/pod.uid":       "uid",
+				attributes.BundleKey:               "bundle",
+				attributes.ConcatenatedFilesKey:    "/ca.crt",
+			},
+		}
+	}
+
+	// The pod name and UID are unknown, so only the namespace, bundle and
+	// outputs are compared
+	if _, err := n.NodePublishVolume(t.Context(), request("namespace")); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if writer.writes != 0 {
+		t.Errorf("expected the already published volume not to be written, got %d writes", writer.writes)
+	}
+
+	if _, err := n.NodePublishVolume(t.Context(), request("other")); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("expected %s for a different namespace, got %v", codes.AlreadyExists, err)
+	}
+}
@@ -18,22 +18,31 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net"
 	"strings"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	grpcPrometheus "github.com/grpc-ecosystem/go-grpc-middleware/providers/prometheus"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 	"k8s.io/apimachinery/pkg/util/uuid"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/health"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/version"
 )
 
@@ -43,7 +52,17 @@ func init() {
 	metrics.Registry.MustRegister(grpcMetrics)
 }
 
-func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundlewriter.BundleWriter) error {
+// Setup runs the gRPC server, the liveness checks are reported by the Probe
+// call of the identity server.
+func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundlewriter.BundleWriter, workers *syncpool.Pool, policy *policy.Policy, livenessChecks map[string]healthz.Checker) error {
+	recorder := mgr.GetEventRecorder(config.DriverName)
+
+	// Kubelet can't publish volumes until the server is listening
+	network, address := parseEndpoint(config.GRPCEndpoint)
+	if err := mgr.AddReadyzCheck("grpc", health.Listening(network, address)); err != nil {
+		return fmt.Errorf("could not add grpc readyz check: %w", err)
+	}
+
 	return mgr.Add(
 		manager.RunnableFunc(func(ctx context.Context) error {
 			// Ensure we don't leak any goroutines by canceling the context on function
@@ -52,7 +71,6 @@ func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundl
 			defer cancel()
 
 			// Create listener for the server
-			network, address := parseEndpoint(config.GRPCEndpoint)
 			lc := net.ListenConfig{}
 			listener, err := lc.Listen(ctx, network, address)
 			if err != nil {
@@ -68,9 +86,20 @@ func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundl
 				grpcMetrics.UnaryServerInterceptor(),
 				// Inject logger into context
 				func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+					// Continue the trace of the caller, if any, and start a
+					// span for the request
+					if md, ok := metadata.FromIncomingContext(ctx); ok {
+						ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+					}
+					ctx, span := tracing.Start(ctx, info.FullMethod, trace.WithSpanKind(trace.SpanKindServer))
+					defer func() { tracing.End(span, err) }()
+
 					// Build the logger for the request and inject it into the
 					// context
 					logger := logger.WithValues("method", info.FullMethod, "request_id", uuid.NewUUID(), "request", protosanitizer.StripSecrets(req))
+					if traceID, ok := tracing.TraceID(ctx); ok {
+						logger = logger.WithValues("trace_id", traceID)
+					}
 					ctx = log.IntoContext(ctx, logger)
 
 					// Call the handler, if there is an error we log it
@@ -90,8 +119,15 @@ func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundl
 			server := grpc.NewServer(unaryInterceptor)
 
 			// Register all services on the GRPC server
-			csi.RegisterNodeServer(server, &NodeServer{Config: config, State: state, BundleWriter: bw})
-			csi.RegisterIdentityServer(server, &IdentityServer{Name: config.DriverName, Version: version.AppVersion})
+			csi.RegisterNodeServer(server, &NodeServer{
+				Config:       config,
+				State:        state,
+				BundleWriter: bw,
+				Workers:      workers,
+				Policy:       policy,
+				Recorder:     recorder,
+			})
+			csi.RegisterIdentityServer(server, &IdentityServer{Name: config.DriverName, Version: version.AppVersion, LivenessChecks: livenessChecks})
 
 			// Initialize prometheus metrics. This MUST be called after all services are
 			// registered on the server.
@@ -108,6 +144,30 @@ func Setup(mgr ctrl.Manager, config *config.Config, state *state.State, bw bundl
 		}))
 }
 
+// metadataCarrier adapts the gRPC metadata to a propagation.TextMapCarrier.
+// Unlike propagation.HeaderCarrier the keys are not canonicalized, as gRPC
+// metadata keys are always lowercase.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
 func parseEndpoint(endpoint string) (proto, addr string) {
 	parts := strings.SplitN(endpoint, "://", 2)
 	if len(parts) == 1 {
@@ -19,20 +19,31 @@ package driver
 import (
 	"context"
 	"fmt"
+	"sync"
+	"time"
 
+	"k8s.io/mount-utils"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
-	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha1"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/controller"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/debug"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/gc"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/health"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/server"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
 )
 
 func Setup(ctx context.Context, mgr ctrl.Manager, config *config.Config) error {
-	metadataEncoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha1.Metadata](mgr.GetScheme())
+	metadataEncoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](mgr.GetScheme())
 	if err != nil {
 		return fmt.Errorf("could not create object encoder for volume metadata: %w", err)
 	}
@@ -42,18 +53,86 @@ func Setup(ctx context.Context, mgr ctrl.Manager, config *config.Config) error {
 		return fmt.Errorf("could not initialize state: %w", err)
 	}
 
+	if err := metrics.Registry.Register(state.Collector()); err != nil {
+		return fmt.Errorf("could not register volume metrics: %w", err)
+	}
+
+	// Volumes that could not be loaded are no longer kept up to date. They are
+	// logged rather than failing readiness, which would stall rollouts until
+	// the Pods using them are gone.
+	quarantined, err := state.Quarantined()
+	if err != nil {
+		return fmt.Errorf("could not list quarantined volumes: %w", err)
+	}
+	if len(quarantined) > 0 {
+		log.FromContext(ctx).Info("volumes quarantined because their metadata could not be loaded", "volumes", quarantined)
+	}
+
+	policy, err := policy.Load(config.PolicyFile)
+	if err != nil {
+		return fmt.Errorf("could not load policy: %w", err)
+	}
+
+	// Readiness: the driver can publish volumes once the volumes of the
+	// previous instance are known, the tmpfs is usable and Bundles can be read
+	// from the informer caches
+	tmpFS := health.TmpFS{Path: config.TmpFSPath(), Mounter: mount.New("")}
+	for name, check := range map[string]healthz.Checker{
+		"state":          state.LoadedCheck,
+		"tmpfs":          tmpFS.Check,
+		"informer-cache": health.CacheSynced(mgr.GetCache().WaitForCacheSync),
+	} {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			return fmt.Errorf("could not add %s readyz check: %w", name, err)
+		}
+	}
+
+	// Liveness: only a restart fixes a tmpfs that is no longer writable, or a
+	// controller whose workers are stuck
+	watchdog := &controller.Watchdog{Timeout: controller.DefaultWatchdogTimeout, Now: time.Now}
+	livenessChecks := map[string]healthz.Checker{
+		"tmpfs":     tmpFS.Check,
+		"reconcile": watchdog.HealthzCheck,
+	}
+	for name, check := range livenessChecks {
+		if err := mgr.AddHealthzCheck(name, check); err != nil {
+			return fmt.Errorf("could not add %s healthz check: %w", name, err)
+		}
+	}
+
+	// The garbage collector only removes store entries while no entry is
+	// being linked into a volume
+	storeLock := new(sync.RWMutex)
+
+	fileWriter := bundlewriter.NewAtomicFileWriter()
+	if config.SharedStorage() {
+		fileWriter = bundlewriter.NewSharedFileWriter(config.StorePath(), storeLock)
+	}
+
 	bundleWriter := bundlewriter.NewBundleWriter(
 		bundlewriter.NewBundleLoader(mgr.GetClient()),
-		bundlewriter.NewAtomicFileWriter(),
+		fileWriter,
 	)
 
-	if err := server.Setup(mgr, config, state, bundleWriter); err != nil {
+	// The initial syncs of volumes being published and Bundle updates share
+	// the workers, so a large update does not starve Pods starting
+	workers := syncpool.New(config.SyncWorkers)
+
+	if err := server.Setup(mgr, config, state, bundleWriter, workers, policy, livenessChecks); err != nil {
 		return fmt.Errorf("could not setup grpc server: %w", err)
 	}
 
-	if err := controller.Setup(mgr, config, state, bundleWriter); err != nil {
+	if err := controller.Setup(mgr, config, state, bundleWriter, workers, watchdog); err != nil {
 		return fmt.Errorf("could not setup controller: %w", err)
 	}
 
+	if err := gc.Setup(mgr, config, state, storeLock); err != nil {
+		return fmt.Errorf("could not setup garbage collector: %w", err)
+	}
+
+	if err := debug.Setup(mgr, config, state); err != nil {
+		return fmt.Errorf("could not setup debug endpoint: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,113 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// checksumPrefix starts the first line of a metadata file, followed by the
+// hex encoded SHA-256 of the rest of the file. It is a YAML comment, so the
+// file can still be read as is.
+const checksumPrefix = "# sha256:"
+
+// addChecksum prepends the checksum line to the encoded data.
+func addChecksum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+
+	out := make([]byte, 0, len(checksumPrefix)+hex.EncodedLen(len(sum))+1+len(data))
+	out = append(out, checksumPrefix...)
+	out = hex.AppendEncode(out, sum[:])
+	out = append(out, '\n')
+	return append(out, data...)
+}
+
+// verifyChecksum strips the checksum line, returning an error if it does not
+// match the rest of the file.
+//
+// Files written before checksums were added have no checksum line, and are
+// returned as is.
+func verifyChecksum(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(checksumPrefix)) {
+		return data, nil
+	}
+
+	line, rest, found := bytes.Cut(data, []byte("\n"))
+	if !found {
+		return nil, errors.New("file truncated after checksum")
+	}
+
+	expected, err := hex.DecodeString(string(line[len(checksumPrefix):]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum: %w", err)
+	}
+
+	if sum := sha256.Sum256(rest); !bytes.Equal(sum[:], expected) {
+		return nil, fmt.Errorf("checksum mismatch, expected %x got %x", expected, sum)
+	}
+
+	return rest, nil
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory
+// and renames it over the target, so a crash leaves either the previous or
+// the new file in place, never a partially written one.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(name)
+
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Cleanup the temporary file if anything fails before the rename
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.Name(), name); err != nil {
+		return err
+	}
+
+	// Sync the directory so the rename itself is persisted
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import "sync"
+
+// keyedMutex is a mutex per key, the mutex of a key is dropped once no
+// goroutine holds or waits for it.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*refCountedMutex
+}
+
+type refCountedMutex struct {
+	sync.Mutex
+	refs int
+}
+
+// Lock locks the mutex of the key, returning the function unlocking it.
+func (k *keyedMutex) Lock(key string) func() {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*refCountedMutex)
+	}
+	lock, exists := k.locks[key]
+	if !exists {
+		lock = &refCountedMutex{}
+		k.locks[key] = lock
+	}
+	lock.refs++
+	k.mu.Unlock()
+
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		lock.refs--
+		if lock.refs == 0 {
+			delete(k.locks, key)
+		}
+	}
+}
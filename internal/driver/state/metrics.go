@@ -0,0 +1,108 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	volumesDesc = prometheus.NewDesc("trust_manager_csi_driver_volumes",
+		"Number of volumes tracked by the driver.",
+		[]string{"bundle", "namespace"}, nil)
+
+	staleVolumesDesc = prometheus.NewDesc("trust_manager_csi_driver_stale_volumes",
+		"Number of volumes whose last sync failed, so may contain an outdated bundle.",
+		[]string{"bundle", "namespace"}, nil)
+
+	certificatesDesc = prometheus.NewDesc("trust_manager_csi_driver_bundle_certificates",
+		"Number of certificates in the bundle last synced to the volumes.",
+		[]string{"bundle", "namespace"}, nil)
+
+	expiryDesc = prometheus.NewDesc("trust_manager_csi_driver_bundle_earliest_expiry_timestamp_seconds",
+		"Earliest NotAfter of the certificates in the bundle mounted in the volumes, as a Unix timestamp.",
+		[]string{"bundle", "namespace"}, nil)
+
+	quarantinedVolumes = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "trust_manager_csi_driver_quarantined_volumes_total",
+		Help: "Number of volumes quarantined on start up because their metadata could not be loaded.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(quarantinedVolumes)
+}
+
+// Collector returns a collector exposing the volumes in the state,
+// aggregated by bundle and namespace. Volumes are never used as a label to
+// keep the cardinality low.
+func (s *State) Collector() prometheus.Collector {
+	return collector{state: s}
+}
+
+type collector struct {
+	state *State
+}
+
+func (c collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- volumesDesc
+	ch <- staleVolumesDesc
+	ch <- certificatesDesc
+	ch <- expiryDesc
+}
+
+func (c collector) Collect(ch chan<- prometheus.Metric) {
+	type key struct{ bundle, namespace string }
+	type aggregate struct {
+		volumes, stale, certificates int
+		notAfter                     float64
+	}
+
+	aggregates := map[key]*aggregate{}
+	for _, volume := range c.state.Statuses() {
+		k := key{bundle: volume.Metadata.Bundle, namespace: volume.Metadata.PodNamespace}
+		a, exists := aggregates[k]
+		if !exists {
+			a = &aggregate{}
+			aggregates[k] = a
+		}
+
+		a.volumes++
+		if volume.Status.Stale() {
+			a.stale++
+		}
+		a.certificates = max(a.certificates, volume.Status.Certificates)
+
+		// The expiry is unknown for volumes not synced since the driver
+		// started
+		if notAfter := volume.Status.NotAfter; !notAfter.IsZero() {
+			if seconds := float64(notAfter.Unix()); a.notAfter == 0 || seconds < a.notAfter {
+				a.notAfter = seconds
+			}
+		}
+	}
+
+	for k, a := range aggregates {
+		ch <- prometheus.MustNewConstMetric(volumesDesc, prometheus.GaugeValue, float64(a.volumes), k.bundle, k.namespace)
+		ch <- prometheus.MustNewConstMetric(staleVolumesDesc, prometheus.GaugeValue, float64(a.stale), k.bundle, k.namespace)
+		ch <- prometheus.MustNewConstMetric(certificatesDesc, prometheus.GaugeValue, float64(a.certificates), k.bundle, k.namespace)
+		if a.notAfter != 0 {
+			ch <- prometheus.MustNewConstMetric(expiryDesc, prometheus.GaugeValue, a.notAfter, k.bundle, k.namespace)
+		}
+	}
+}
@@ -17,16 +17,24 @@ limitations under the License.
 package state
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
+	"path"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"k8s.io/mount-utils"
 	"k8s.io/utils/set"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
 	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
 )
 
@@ -39,8 +47,25 @@ type State struct {
 	mu               sync.RWMutex
 	volumeToMetadata map[string]metadata.Metadata
 	bundleToVolumeID index
+	volumeToStatus   map[string]VolumeStatus
 	metadataEncoder  ObjectEncoder[metadata.Metadata]
 	config           *config.Config
+	// loaded is set once the volumes of a previous instance have been loaded
+	loaded bool
+	// volumeLocks serializes the operations writing to a volume directory
+	volumeLocks keyedMutex
+}
+
+// NewState returns an empty state, use InitializeState to load the volumes
+// from a previous instance.
+func NewState(config *config.Config, metadataEncoder ObjectEncoder[metadata.Metadata]) *State {
+	return &State{
+		volumeToMetadata: make(map[string]metadata.Metadata),
+		bundleToVolumeID: index{},
+		volumeToStatus:   make(map[string]VolumeStatus),
+		config:           config,
+		metadataEncoder:  metadataEncoder,
+	}
 }
 
 // InitializeState will setup the persistent state required by the CSI
@@ -49,30 +74,35 @@ type State struct {
 // 1. Ensure the tmpfs mount exists, creating if necessary
 // 2. Loading config for existing volumes left over from a previous instance
 func InitializeState(ctx context.Context, config *config.Config, metadataEncoder ObjectEncoder[metadata.Metadata]) (*State, error) {
-	logger := log.FromContext(ctx)
-
 	// Create empty state
-	state := &State{
-		volumeToMetadata: make(map[string]metadata.Metadata),
-		bundleToVolumeID: index{},
-		config:           config,
-		metadataEncoder:  metadataEncoder,
+	state := NewState(config, metadataEncoder)
+
+	if err := ensureTmpFS(ctx, config.TmpFSPath()); err != nil {
+		return nil, err
+	}
+
+	if err := state.Load(ctx); err != nil {
+		return nil, err
 	}
 
-	// The volumes are stored in a tmpfs mount, this is used multiple times in
-	// this function so we define a variable up here to keep it clean.
-	tmpFSPath := config.TmpFSPath()
+	return state, nil
+}
+
+// ensureTmpFS mounts the tmpfs the volumes are stored in, if it is not
+// already mounted.
+func ensureTmpFS(ctx context.Context, tmpFSPath string) error {
+	logger := log.FromContext(ctx)
 
 	// If the tmpfs mount does not exist, create it.
 	mount := mount.New("")
 	isMnt, err := mount.IsMountPoint(tmpFSPath)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			return nil, err
+			return err
 		}
 
 		if err := os.MkdirAll(tmpFSPath, 0700); err != nil {
-			return nil, err
+			return err
 		}
 	}
 
@@ -81,68 +111,270 @@ func InitializeState(ctx context.Context, config *config.Config, metadataEncoder
 	} else {
 		logger.Info("creating tmpsfs mount", "path", tmpFSPath)
 		if err := mount.Mount("tmpfs", tmpFSPath, "tmpfs", []string{}); err != nil {
-			return nil, fmt.Errorf("could not mount tmpfs: %w", err)
+			return fmt.Errorf("could not mount tmpfs: %w", err)
 		}
 	}
 
+	return nil
+}
+
+// Load adds the volumes left over from a previous instance to the state.
+//
+// A volume whose metadata can't be read or decoded is moved to the quarantine
+// directory instead of failing the whole driver. It is no longer synced, but
+// stays in place for any Pod still using it until the garbage collector
+// removes it.
+func (s *State) Load(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+
 	// Each folder within the tmpfs path is a volume, with the folder name being
 	// the volume id
-	entries, err := os.ReadDir(tmpFSPath)
+	entries, err := os.ReadDir(s.config.TmpFSPath())
 	if err != nil {
-		return nil, fmt.Errorf("could not list volumes: %w", err)
+		return fmt.Errorf("could not list volumes: %w", err)
 	}
 
 	// Attempt to load the metadata for each of the discovered folders
 	for _, entry := range entries {
-		// The volume id is always the folder name, the metadata path is the
-		// json file within that dir containing the metadata for that volume
+		// The volume id is always the folder name, hidden folders such as the
+		// quarantine directory are not volumes
 		volumeID := entry.Name()
+		if config.IsHidden(volumeID) {
+			continue
+		}
 		logger.Info("found existing volume", "volume_id", volumeID)
 
-		// Read the metadata for the given volume
-		metadataPath := config.MetadataPathForVolume(volumeID)
-		data, err := os.ReadFile(metadataPath)
+		meta, migrate, err := s.loadMetadata(volumeID)
 		if err != nil {
-			return nil, fmt.Errorf("could not read metadata for volume %q: %w", volumeID, err)
+			logger.Error(err, "quarantining volume with invalid metadata", "volume_id", volumeID)
+			if err := s.quarantine(volumeID); err != nil {
+				return fmt.Errorf("could not quarantine volume %q: %w", volumeID, err)
+			}
+			quarantinedVolumes.Inc()
+			continue
 		}
 
-		// Decode the metadata file into the metadata object
-		meta, err := metadataEncoder.Decode(data)
-		if err != nil {
-			return nil, fmt.Errorf("could not decode metadata for volume %q: %w", volumeID, err)
+		// Failing to migrate is not fatal, the metadata can still be read
+		if migrate && s.config.MigrateMetadata {
+			logger.Info("migrating volume metadata to the storage version", "volume_id", volumeID)
+			if err := s.writeMetadata(meta); err != nil {
+				logger.Error(err, "could not migrate volume metadata", "volume_id", volumeID)
+			}
 		}
 
-		// Insert loaded metadata into the state
-		state.volumeToMetadata[volumeID] = meta
-		state.bundleToVolumeID.Insert(meta.Bundle, volumeID)
+		// Insert loaded metadata into the state, when the volume was last
+		// synced is not persisted
+		s.mu.Lock()
+		s.volumeToMetadata[volumeID] = meta
+		s.bundleToVolumeID.Insert(meta.Bundle, volumeID)
+		s.volumeToStatus[volumeID] = VolumeStatus{Hash: meta.LastSyncedHash, Certificates: meta.LastSyncedCertificates}
+		s.mu.Unlock()
 	}
 
-	return state, nil
+	s.mu.Lock()
+	s.loaded = true
+	s.mu.Unlock()
+
+	return nil
+}
+
+// LoadedCheck fails until the volumes of a previous instance have been loaded,
+// volumes published before then would be unknown to the state.
+func (s *State) LoadedCheck(*http.Request) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if !s.loaded {
+		return errors.New("volumes of the previous instance have not been loaded")
+	}
+	return nil
+}
+
+// loadMetadata reads the metadata of the volume, also returning whether the
+// file differs from what would be written now, e.g. it was written in an
+// older version.
+func (s *State) loadMetadata(volumeID string) (metadata.Metadata, bool, error) {
+	// Read the metadata for the given volume
+	file, err := os.ReadFile(s.config.MetadataPathForVolume(volumeID))
+	if err != nil {
+		return metadata.Metadata{}, false, fmt.Errorf("could not read metadata: %w", err)
+	}
+
+	// Detect files that were partially written or corrupted
+	data, err := verifyChecksum(file)
+	if err != nil {
+		return metadata.Metadata{}, false, fmt.Errorf("could not verify metadata: %w", err)
+	}
+
+	// Decode the metadata file into the metadata object
+	meta, err := s.metadataEncoder.Decode(data)
+	if err != nil {
+		return metadata.Metadata{}, false, fmt.Errorf("could not decode metadata: %w", err)
+	}
+
+	// Encoding is deterministic, so any difference means the file was written
+	// by an older version
+	current, err := s.metadataEncoder.Encode(meta)
+	if err != nil {
+		return metadata.Metadata{}, false, fmt.Errorf("could not encode metadata: %w", err)
+	}
+
+	return meta, !bytes.Equal(addChecksum(current), file), nil
+}
+
+// quarantine moves the volume directory into the quarantine directory. The
+// rename keeps any existing bind mount of the data directory working.
+func (s *State) quarantine(volumeID string) error {
+	if err := os.MkdirAll(s.config.QuarantinePath(), 0700); err != nil {
+		return err
+	}
+
+	target := path.Join(s.config.QuarantinePath(), fmt.Sprintf("%s-%d", volumeID, time.Now().Unix()))
+	return os.Rename(s.config.RootPathForVolume(volumeID), target)
+}
+
+// Quarantined returns the volume directories that have been quarantined and
+// not yet removed by the garbage collector.
+func (s *State) Quarantined() ([]string, error) {
+	entries, err := os.ReadDir(s.config.QuarantinePath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
 }
 
 // Track adds a volume to the state, meaning the controller can resume managing
-// it if restarted
+// it if restarted. The volume is expected to have just been synced, with the
+// result in the metadata.
 func (s *State) Track(meta metadata.Metadata) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if err := s.writeMetadata(meta); err != nil {
+		return err
+	}
+
+	// Add to internal map and index
+	s.volumeToMetadata[meta.VolumeID] = meta
+	s.bundleToVolumeID.Insert(meta.Bundle, meta.VolumeID)
+
+	now := time.Now()
+	s.volumeToStatus[meta.VolumeID] = VolumeStatus{
+		LastAttempt:  now,
+		LastSuccess:  now,
+		Hash:         meta.LastSyncedHash,
+		Certificates: meta.LastSyncedCertificates,
+	}
+
+	return nil
+}
+
+// SetSynced records the contents last written to a volume, returning the
+// metadata as it was before. The metadata is only persisted when the contents
+// changed, so a restart can tell whether the volume is up to date.
+//
+// Volumes that are no longer in the state, e.g. they are being unpublished,
+// are ignored.
+func (s *State) SetSynced(id string, result bundlewriter.SyncResult) (metadata.Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.volumeToMetadata[id]
+	if !exists {
+		return previous, nil
+	}
+
+	now := time.Now()
+	s.volumeToStatus[id] = VolumeStatus{
+		LastAttempt:  now,
+		LastSuccess:  now,
+		Hash:         result.Hash,
+		Certificates: result.Certificates,
+		NotAfter:     result.NotAfter,
+	}
+
+	if previous.LastSyncedHash == result.Hash {
+		return previous, nil
+	}
+
+	meta := previous
+	meta.LastSyncedHash = result.Hash
+	meta.LastSyncedCertificates = result.Certificates
+
+	if err := s.writeMetadata(meta); err != nil {
+		return previous, err
+	}
+	s.volumeToMetadata[id] = meta
+
+	return previous, nil
+}
+
+// SetSyncFailed records that the last sync of a volume failed, the volume
+// keeps the contents of the last successful sync.
+func (s *State) SetSyncFailed(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.volumeToMetadata[id]; !exists {
+		return
+	}
+
+	status := s.volumeToStatus[id]
+	status.LastAttempt = time.Now()
+	if status.LastError == "" {
+		status.FailingSince = status.LastAttempt
+	}
+	status.LastError = err.Error()
+	s.volumeToStatus[id] = status
+}
+
+// GetStatus returns the sync status of a volume in the state.
+func (s *State) GetStatus(id string) VolumeStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.volumeToStatus[id]
+}
+
+// Statuses returns the sync status of every volume in the state, along with
+// its metadata.
+func (s *State) Statuses() []VolumeStatusWithMetadata {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	statuses := make([]VolumeStatusWithMetadata, 0, len(s.volumeToMetadata))
+	for id, meta := range s.volumeToMetadata {
+		statuses = append(statuses, VolumeStatusWithMetadata{Metadata: meta, Status: s.volumeToStatus[id]})
+	}
+	slices.SortFunc(statuses, func(a, b VolumeStatusWithMetadata) int {
+		return strings.Compare(a.Metadata.VolumeID, b.Metadata.VolumeID)
+	})
+	return statuses
+}
+
+// writeMetadata persists the metadata of the volume in the storage version.
+func (s *State) writeMetadata(meta metadata.Metadata) error {
 	// Encode the metadata for storage
 	data, err := s.metadataEncoder.Encode(meta)
 	if err != nil {
 		return fmt.Errorf("could not encode metadata for volume %q: %w", meta.VolumeID, err)
 	}
 
-	// Create the metadata.json file
+	// Write the metadata file atomically, the metadata is only read by the
+	// driver itself
 	metadataPath := s.config.MetadataPathForVolume(meta.VolumeID)
-	//nolint:gosec // FIXME: Review required permissions
-	if err := os.WriteFile(metadataPath, data, 0644); err != nil {
+	if err := writeFileAtomic(metadataPath, addChecksum(data), 0600); err != nil {
 		return fmt.Errorf("could not write metadata for volume %q: %w", meta.VolumeID, err)
 	}
 
-	// Add to internal map and index
-	s.volumeToMetadata[meta.VolumeID] = meta
-	s.bundleToVolumeID.Insert(meta.Bundle, meta.VolumeID)
-
 	return nil
 }
 
@@ -163,6 +395,77 @@ func (s *State) StopSync(id string) error {
 	return nil
 }
 
+// Untrack removes a volume from the state entirely, this is used once the
+// volume has been cleaned up.
+//
+// This does not delete the persisted metadata file, the caller is expected to
+// have removed the volume directory.
+func (s *State) Untrack(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if meta, exists := s.volumeToMetadata[id]; exists {
+		s.bundleToVolumeID.Delete(meta.Bundle, id)
+		delete(s.volumeToMetadata, id)
+	}
+	delete(s.volumeToStatus, id)
+}
+
+// VolumeIDs returns the IDs of all the volumes in the state, including
+// volumes that are no longer synced.
+func (s *State) VolumeIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.volumeToMetadata))
+	for id := range s.volumeToMetadata {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Bundles returns the names of the bundles synced to at least one volume.
+func (s *State) Bundles() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	bundles := make([]string, 0, len(s.bundleToVolumeID))
+	for bundle := range s.bundleToVolumeID {
+		bundles = append(bundles, bundle)
+	}
+	return bundles
+}
+
+// LockVolume locks the volume until the returned function is called. It is
+// held by every operation writing to or removing the volume directory, i.e.
+// publishing, unpublishing, syncing and garbage collecting the volume, so
+// they don't interleave. The volume does not need to be in the state.
+func (s *State) LockVolume(id string) func() {
+	return s.volumeLocks.Lock(id)
+}
+
+// GetSyncedMetadata returns the metadata of a volume the controller syncs,
+// i.e. it is in the state and StopSync was not called.
+func (s *State) GetSyncedMetadata(id string) (metadata.Metadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, exists := s.volumeToMetadata[id]
+	if !exists || !s.bundleToVolumeID[meta.Bundle].Has(id) {
+		return metadata.Metadata{}, false
+	}
+	return meta, true
+}
+
+// GetMetadata returns the metadata of a volume in the state.
+func (s *State) GetMetadata(id string) (metadata.Metadata, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	meta, exists := s.volumeToMetadata[id]
+	return meta, exists
+}
+
 // GetMetadataForBundle returns the metadata for a given bundle name, each
 // metadata item relates to a single volume that may require a re-sync.
 func (s *State) GetMetadataForBundle(name string) []metadata.Metadata {
@@ -177,6 +480,39 @@ func (s *State) GetMetadataForBundle(name string) []metadata.Metadata {
 	return meta
 }
 
+// VolumeStatus is the sync status of a volume, it is only kept in memory.
+type VolumeStatus struct {
+	// LastAttempt is when the volume was last synced, whether it succeeded
+	// or not
+	LastAttempt time.Time
+	// LastSuccess is when the volume was last synced successfully
+	LastSuccess time.Time
+	// LastError is the error of the last sync, empty if it succeeded
+	LastError string
+	// FailingSince is when the first of the consecutive failed syncs happened
+	FailingSince time.Time
+	// Hash of the contents of the volume, see bundlewriter.SyncResult
+	Hash string
+	// Certificates is the number of certificates in the volume
+	Certificates int
+	// NotAfter is the earliest expiry of the certificates in the volume,
+	// unknown until the volume has been synced by this instance
+	NotAfter time.Time
+}
+
+// Stale returns whether the volume may be serving an outdated bundle because
+// the last sync failed.
+func (s VolumeStatus) Stale() bool {
+	return s.LastError != ""
+}
+
+// VolumeStatusWithMetadata is the sync status of a volume along with its
+// metadata.
+type VolumeStatusWithMetadata struct {
+	Metadata metadata.Metadata
+	Status   VolumeStatus
+}
+
 type index map[string]set.Set[string]
 
 func (i index) Insert(k string, v string) {
@@ -0,0 +1,407 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package state_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/ptr"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha1"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/bundlewriter"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/config"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/state"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+)
+
+func TestLoad(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := encoder.Encode(metadata.Metadata{VolumeID: "valid", Bundle: "bundle"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volumes := map[string][]byte{
+		"valid":     valid,
+		"truncated": valid[:len(valid)/2],
+		"missing":   nil,
+		"unknown-api-version": []byte(strings.Replace(string(valid),
+			v1alpha2.SchemeGroupVersion.String(), "config.csi.trust-manager.io/v1beta9", 1)),
+	}
+
+	for volumeID, data := range volumes {
+		if err := os.MkdirAll(cfg.DataPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if data == nil {
+			continue
+		}
+		if err := os.WriteFile(cfg.MetadataPathForVolume(volumeID), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := state.NewState(cfg, encoder)
+	if err := s.Load(t.Context()); err != nil {
+		t.Fatalf("expected invalid volumes to be quarantined, got error: %s", err)
+	}
+
+	if ids := s.VolumeIDs(); !slices.Equal(ids, []string{"valid"}) {
+		t.Errorf("expected only the valid volume to be loaded, got %v", ids)
+	}
+	if meta := s.GetMetadataForBundle("bundle"); len(meta) != 1 || meta[0].VolumeID != "valid" {
+		t.Errorf("expected the valid volume to be synced for the bundle, got %v", meta)
+	}
+
+	quarantined, err := s.Quarantined()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quarantined) != 3 {
+		t.Errorf("expected 3 quarantined volumes, got %v", quarantined)
+	}
+	for _, volumeID := range []string{"truncated", "missing", "unknown-api-version"} {
+		if _, err := os.Stat(cfg.RootPathForVolume(volumeID)); !os.IsNotExist(err) {
+			t.Errorf("expected volume %q to be moved out of the tmpfs root, got %v", volumeID, err)
+		}
+		if !slices.ContainsFunc(quarantined, func(name string) bool { return strings.HasPrefix(name, volumeID+"-") }) {
+			t.Errorf("expected volume %q to be quarantined, got %v", volumeID, quarantined)
+		}
+	}
+
+	// Loading again, e.g. after another restart, must ignore the quarantine
+	// directory
+	s = state.NewState(cfg, encoder)
+	if err := s.Load(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ids := s.VolumeIDs(); !slices.Equal(ids, []string{"valid"}) {
+		t.Errorf("expected only the valid volume to be loaded, got %v", ids)
+	}
+}
+
+func TestTrack(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, volumeID := range []string{"valid", "corrupted"} {
+		if err := os.MkdirAll(cfg.DataPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := state.NewState(cfg, encoder)
+	for _, volumeID := range []string{"valid", "corrupted"} {
+		// Track twice to replace the existing file
+		for range 2 {
+			if err := s.Track(newMetadata(volumeID)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	info, err := os.Stat(cfg.MetadataPathForVolume("valid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("expected metadata file mode 0600, got %o", mode)
+	}
+
+	entries, err := os.ReadDir(cfg.RootPathForVolume("valid"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected only the data directory and metadata file, got %v", entries)
+	}
+
+	// Flip a value without changing the length of the file, the checksum
+	// must catch it
+	data, err := os.ReadFile(cfg.MetadataPathForVolume("corrupted"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("bundle: bundle"), []byte("bundle: bundlf"), 1)
+	if err := os.WriteFile(cfg.MetadataPathForVolume("corrupted"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s = state.NewState(cfg, encoder)
+	if err := s.Load(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ids := s.VolumeIDs(); !slices.Equal(ids, []string{"valid"}) {
+		t.Errorf("expected only the valid volume to be loaded, got %v", ids)
+	}
+	if meta, _ := s.GetMetadata("valid"); !reflect.DeepEqual(meta, newMetadata("valid")) {
+		t.Errorf("expected metadata %+v to be loaded, got %+v", newMetadata("valid"), meta)
+	}
+}
+
+func newMetadata(volumeID string) metadata.Metadata {
+	return metadata.Metadata{
+		VolumeID:          volumeID,
+		PodNamespace:      "namespace",
+		PodName:           "pod",
+		PodUID:            "5f0c7a3e-9d4b-4c1e-8a43-2b6f1e0d9c7a",
+		PodServiceAccount: "default",
+		Bundle:            "bundle",
+		Outputs: []metadata.Output{
+			{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca.crt", Mode: ptr.To[int32](0444)},
+		},
+		CreationTimestamp: metav1.Unix(1700000000, 0),
+	}
+}
+
+func TestLoadV1alpha1(t *testing.T) {
+	tests := map[string]struct {
+		migrate bool
+	}{
+		"without migration": {migrate: false},
+		"with migration":    {migrate: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := &config.Config{DataDir: t.TempDir(), MigrateMetadata: test.migrate}
+
+			// Metadata written by a previous version of the driver, without
+			// a checksum
+			oldEncoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha1.Metadata](scheme.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+			encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// v1alpha1 has no mode, the pod is unknown
+			meta := metadata.Metadata{
+				VolumeID:     "volume",
+				PodNamespace: "namespace",
+				Bundle:       "bundle",
+				Outputs: []metadata.Output{
+					{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca-certificates.crt"},
+				},
+			}
+			old, err := oldEncoder.Encode(meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := os.MkdirAll(cfg.DataPathForVolume("volume"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cfg.MetadataPathForVolume("volume"), old, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			s := state.NewState(cfg, encoder)
+			if err := s.Load(t.Context()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			loaded := s.GetMetadataForBundle("bundle")
+			if len(loaded) != 1 || !reflect.DeepEqual(loaded[0], meta) {
+				t.Fatalf("expected metadata %+v to be loaded, got %+v", meta, loaded)
+			}
+
+			data, err := os.ReadFile(cfg.MetadataPathForVolume("volume"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			migrated := !bytes.Equal(data, old)
+			if migrated != test.migrate {
+				t.Fatalf("expected metadata to be migrated %t, got %t:\n%s", test.migrate, migrated, data)
+			}
+			if migrated && !bytes.Contains(data, []byte("apiVersion: "+v1alpha2.SchemeGroupVersion.String())) {
+				t.Fatalf("expected metadata to be rewritten as %s, got:\n%s", v1alpha2.SchemeGroupVersion, data)
+			}
+
+			// Either way the volume must load again after a restart
+			s = state.NewState(cfg, encoder)
+			if err := s.Load(t.Context()); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if loaded := s.GetMetadataForBundle("bundle"); len(loaded) != 1 || !reflect.DeepEqual(loaded[0], meta) {
+				t.Fatalf("expected metadata %+v to be loaded after restart, got %+v", meta, loaded)
+			}
+		})
+	}
+}
+
+func TestV1alpha2RoundTrip(t *testing.T) {
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	meta := newMetadata("volume")
+	meta.Outputs = append(meta.Outputs, metadata.Output{
+		Format:  metadata.OutputFormatOpenSSLRehash,
+		Path:    "/certs",
+		UID:     ptr.To[int64](1000),
+		GID:     ptr.To[int64](2000),
+		Filters: &metadata.OutputFilters{ExcludeExpired: true},
+	})
+	meta.LastSyncedHash = "abc"
+	meta.LastSyncedCertificates = 2
+
+	data, err := encoder.Encode(meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"apiVersion: " + v1alpha2.SchemeGroupVersion.String(), "excludeExpired: true"} {
+		if !bytes.Contains(data, []byte(expected)) {
+			t.Errorf("expected encoded metadata to contain %q, got:\n%s", expected, data)
+		}
+	}
+
+	decoded, err := encoder.Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, meta) {
+		t.Fatalf("expected metadata %+v after a round trip, got %+v", meta, decoded)
+	}
+}
+
+func TestSyncStatus(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewState(cfg, encoder)
+	for _, volumeID := range []string{"volume-b", "volume-a"} {
+		if err := os.MkdirAll(cfg.DataPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		meta := newMetadata(volumeID)
+		meta.LastSyncedHash, meta.LastSyncedCertificates = "hash-1", 1
+		if err := s.Track(meta); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status := s.GetStatus("volume-a")
+	if status.Stale() || status.LastSuccess.IsZero() || status.Hash != "hash-1" || status.Certificates != 1 {
+		t.Fatalf("expected a synced status after tracking, got %+v", status)
+	}
+
+	s.SetSyncFailed("volume-a", errors.New("first"))
+	failingSince := s.GetStatus("volume-a").FailingSince
+	s.SetSyncFailed("volume-a", errors.New("second"))
+
+	status = s.GetStatus("volume-a")
+	if !status.Stale() || status.LastError != "second" || !status.FailingSince.Equal(failingSince) || status.Hash != "hash-1" {
+		t.Fatalf("expected a stale status keeping the first failure time, got %+v", status)
+	}
+
+	statuses := s.Statuses()
+	if len(statuses) != 2 || statuses[0].Metadata.VolumeID != "volume-a" || !statuses[0].Status.Stale() || statuses[1].Status.Stale() {
+		t.Fatalf("expected the statuses of both volumes sorted by volume ID, got %+v", statuses)
+	}
+
+	if _, err := s.SetSynced("volume-a", bundlewriter.SyncResult{Hash: "hash-2", Certificates: 2}); err != nil {
+		t.Fatal(err)
+	}
+	status = s.GetStatus("volume-a")
+	if status.Stale() || status.Hash != "hash-2" || status.Certificates != 2 || status.LastAttempt.Before(failingSince) {
+		t.Fatalf("expected a synced status, got %+v", status)
+	}
+
+	// The hash and number of certificates are persisted
+	s = state.NewState(cfg, encoder)
+	if err := s.Load(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if status := s.GetStatus("volume-a"); status.Hash != "hash-2" || status.Certificates != 2 {
+		t.Fatalf("expected the last synced contents to be loaded, got %+v", status)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	cfg := &config.Config{DataDir: t.TempDir()}
+
+	encoder, err := state.NewVersionedObjectEncoder[metadata.Metadata, v1alpha2.Metadata](scheme.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := state.NewState(cfg, encoder)
+	for _, volumeID := range []string{"volume-a", "volume-b", "volume-c"} {
+		if err := os.MkdirAll(cfg.DataPathForVolume(volumeID), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Track(newMetadata(volumeID)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := s.SetSynced("volume-a", bundlewriter.SyncResult{Hash: "hash", Certificates: 2, NotAfter: time.Unix(2000, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetSynced("volume-b", bundlewriter.SyncResult{Hash: "hash", Certificates: 2, NotAfter: time.Unix(1000, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	s.SetSyncFailed("volume-c", errors.New("failed"))
+
+	expected := `
+# HELP trust_manager_csi_driver_bundle_certificates Number of certificates in the bundle last synced to the volumes.
+# TYPE trust_manager_csi_driver_bundle_certificates gauge
+trust_manager_csi_driver_bundle_certificates{bundle="bundle",namespace="namespace"} 2
+# HELP trust_manager_csi_driver_bundle_earliest_expiry_timestamp_seconds Earliest NotAfter of the certificates in the bundle mounted in the volumes, as a Unix timestamp.
+# TYPE trust_manager_csi_driver_bundle_earliest_expiry_timestamp_seconds gauge
+trust_manager_csi_driver_bundle_earliest_expiry_timestamp_seconds{bundle="bundle",namespace="namespace"} 1000
+# HELP trust_manager_csi_driver_stale_volumes Number of volumes whose last sync failed, so may contain an outdated bundle.
+# TYPE trust_manager_csi_driver_stale_volumes gauge
+trust_manager_csi_driver_stale_volumes{bundle="bundle",namespace="namespace"} 1
+# HELP trust_manager_csi_driver_volumes Number of volumes tracked by the driver.
+# TYPE trust_manager_csi_driver_volumes gauge
+trust_manager_csi_driver_volumes{bundle="bundle",namespace="namespace"} 3
+`
+	if err := testutil.CollectAndCompare(s.Collector(), strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
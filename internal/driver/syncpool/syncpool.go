@@ -0,0 +1,159 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package syncpool bounds the number of volumes synced concurrently.
+//
+// Both the initial sync of a volume being published and the syncs updating
+// volumes on Bundle changes take a worker from the same pool, the initial
+// syncs are handed a worker first since a Pod is waiting for them to start.
+package syncpool
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// Priority of a sync, lower values are handed a worker first.
+type Priority int
+
+const (
+	// PriorityPublish is the priority of the initial sync of a volume being
+	// published
+	PriorityPublish Priority = iota
+	// PriorityBackground is the priority of the syncs updating published
+	// volumes
+	PriorityBackground
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityPublish:
+		return "publish"
+	case PriorityBackground:
+		return "background"
+	default:
+		return "unknown"
+	}
+}
+
+var waitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "trust_manager_csi_driver_sync_wait_duration_seconds",
+	Help:    "Time syncs waited for a free worker.",
+	Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+}, []string{"priority"})
+
+func init() {
+	metrics.Registry.MustRegister(waitDuration)
+}
+
+// Pool runs a bounded number of syncs concurrently.
+type Pool struct {
+	mu      sync.Mutex
+	workers int
+	running int
+	// waiting are the syncs waiting for a worker by priority, in the order
+	// they arrived
+	waiting [numPriorities][]chan struct{}
+}
+
+// New returns a pool of the given number of workers, at least one.
+func New(workers int) *Pool {
+	return &Pool{workers: max(workers, 1)}
+}
+
+// Do runs fn once a worker is free, or returns the error of the context if it
+// is done first. A nil pool runs fn immediately.
+func (p *Pool) Do(ctx context.Context, priority Priority, fn func()) error {
+	if p == nil {
+		fn()
+		return nil
+	}
+
+	start := time.Now()
+	if err := p.acquire(ctx, priority); err != nil {
+		return err
+	}
+	defer p.release()
+	waitDuration.WithLabelValues(priority.String()).Observe(time.Since(start).Seconds())
+
+	fn()
+	return nil
+}
+
+func (p *Pool) acquire(ctx context.Context, priority Priority) error {
+	p.mu.Lock()
+	// Workers are handed over on release while syncs are waiting, so a free
+	// worker means nothing is waiting
+	if p.running < p.workers {
+		p.running++
+		p.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	p.waiting[priority] = append(p.waiting[priority], ready)
+	p.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		select {
+		case <-ready:
+			// The worker was handed over while giving up, pass it on
+			p.releaseLocked()
+		default:
+			p.waiting[priority] = slices.DeleteFunc(p.waiting[priority], func(c chan struct{}) bool {
+				return c == ready
+			})
+		}
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) release() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.releaseLocked()
+}
+
+// releaseLocked hands the worker over to the first sync waiting with the
+// highest priority, or frees it if none is waiting.
+func (p *Pool) releaseLocked() {
+	for priority := range p.waiting {
+		if len(p.waiting[priority]) == 0 {
+			continue
+		}
+
+		ready := p.waiting[priority][0]
+		p.waiting[priority] = p.waiting[priority][1:]
+		close(ready)
+		return
+	}
+
+	p.running--
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syncpool_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/syncpool"
+)
+
+func TestPoolPriority(t *testing.T) {
+	pool := syncpool.New(1)
+
+	// Hold the only worker until the syncs below are waiting for it
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = pool.Do(t.Context(), syncpool.PriorityBackground, func() {
+			close(holding)
+			<-release
+		})
+	}()
+	<-holding
+
+	var (
+		mu    sync.Mutex
+		order []string
+		wg    sync.WaitGroup
+	)
+	do := func(name string, priority syncpool.Priority) {
+		wg.Go(func() {
+			if err := pool.Do(t.Context(), priority, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				order = append(order, name)
+			}); err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+		})
+		// Let the sync queue up before the next one
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	do("background-1", syncpool.PriorityBackground)
+	do("publish-1", syncpool.PriorityPublish)
+	do("background-2", syncpool.PriorityBackground)
+	do("publish-2", syncpool.PriorityPublish)
+
+	close(release)
+	wg.Wait()
+
+	if expected := []string{"publish-1", "publish-2", "background-1", "background-2"}; !slices.Equal(order, expected) {
+		t.Fatalf("expected syncs to run in order %v, got %v", expected, order)
+	}
+}
+
+func TestPoolCanceled(t *testing.T) {
+	pool := syncpool.New(1)
+
+	holding := make(chan struct{})
+	release := make(chan struct{})
+	go func() {
+		_ = pool.Do(t.Context(), syncpool.PriorityBackground, func() {
+			close(holding)
+			<-release
+		})
+	}()
+	<-holding
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	ran := false
+	if err := pool.Do(ctx, syncpool.PriorityPublish, func() { ran = true }); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to be exceeded, got %v", err)
+	}
+	if ran {
+		t.Fatalf("expected the sync not to run once canceled")
+	}
+
+	// The canceled sync must not keep the worker once it is released
+	close(release)
+	done := make(chan struct{})
+	go func() {
+		_ = pool.Do(t.Context(), syncpool.PriorityBackground, func() { close(done) })
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected the worker to be free")
+	}
+}
@@ -23,12 +23,14 @@ import (
 
 	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
 	metadatav1alpha1 "github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha1"
+	metadatav1alpha2 "github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata/v1alpha2"
 )
 
 func New() *runtime.Scheme {
 	scheme := runtime.NewScheme()
 	_ = metadata.AddToScheme(scheme)
 	_ = metadatav1alpha1.AddToScheme(scheme)
+	_ = metadatav1alpha2.AddToScheme(scheme)
 	_ = trustv1alpha1.AddToScheme(scheme)
 	_ = kubernetes.AddToScheme(scheme)
 	return scheme
@@ -0,0 +1,148 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tracing configures OpenTelemetry tracing, and contains helpers to
+// create spans with the driver's tracer.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/version"
+)
+
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP exports spans to an OTLP gRPC endpoint
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout, this is meant for local testing
+	ExporterStdout = "stdout"
+
+	serviceName = "trust-manager-csi-driver"
+)
+
+// Config is the tracing config, populated from command line flags
+type Config struct {
+	// Exporter is one of ExporterNone, ExporterOTLP or ExporterStdout
+	Exporter string
+	// OTLPEndpoint is the host:port of the OTLP gRPC endpoint, if empty the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used
+	OTLPEndpoint string
+	// OTLPInsecure disables TLS when connecting to the OTLP endpoint
+	OTLPInsecure bool
+	// SampleRatio is the ratio of traces sampled, unless the parent span was
+	// sampled
+	SampleRatio float64
+}
+
+// Validate checks the config is valid.
+func (c Config) Validate() error {
+	switch c.Exporter {
+	case ExporterNone, ExporterOTLP, ExporterStdout:
+	default:
+		return fmt.Errorf("unknown tracing exporter %q, must be one of %q, %q or %q", c.Exporter, ExporterNone, ExporterOTLP, ExporterStdout)
+	}
+
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1, got %v", c.SampleRatio)
+	}
+
+	return nil
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes any pending spans and must be called on shutdown.
+//
+// With ExporterNone the global no-op tracer provider is left in place, so
+// creating spans has next to no overhead.
+func Setup(ctx context.Context, c Config) (func(context.Context) error, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch c.Exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		opts := []otlptracegrpc.Option{}
+		if c.OTLPEndpoint != "" {
+			opts = append(opts, otlptracegrpc.WithEndpoint(c.OTLPEndpoint))
+		}
+		if c.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		exporter, err = otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %w", c.Exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(c.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", version.AppVersion),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Start creates a span with the driver's tracer. The global tracer provider is
+// looked up on every call, so spans are only recorded once Setup has been
+// called.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(serviceName).Start(ctx, name, opts...)
+}
+
+// End ends the span, marking it as failed if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns the ID of the trace of the span in the context, so log lines
+// can be correlated with traces.
+func TraceID(ctx context.Context) (string, bool) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return "", false
+	}
+	return spanContext.TraceID().String(), true
+}
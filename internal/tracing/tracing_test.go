@@ -0,0 +1,95 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tracing_test
+
+import (
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/tracing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := map[string]struct {
+		config    tracing.Config
+		expectErr bool
+	}{
+		"none":            {config: tracing.Config{Exporter: tracing.ExporterNone}},
+		"otlp":            {config: tracing.Config{Exporter: tracing.ExporterOTLP, SampleRatio: 0.5}},
+		"stdout":          {config: tracing.Config{Exporter: tracing.ExporterStdout, SampleRatio: 1}},
+		"unknown":         {config: tracing.Config{Exporter: "jaeger"}, expectErr: true},
+		"negative ratio":  {config: tracing.Config{Exporter: tracing.ExporterNone, SampleRatio: -1}, expectErr: true},
+		"ratio above one": {config: tracing.Config{Exporter: tracing.ExporterNone, SampleRatio: 2}, expectErr: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := test.config.Validate()
+			if test.expectErr != (err != nil) {
+				t.Fatalf("expected error %t, got %v", test.expectErr, err)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, parent := tracing.Start(t.Context(), "parent")
+	traceID, ok := tracing.TraceID(ctx)
+	if !ok {
+		t.Fatalf("expected trace ID in context")
+	}
+
+	_, child := tracing.Start(ctx, "child")
+	tracing.End(child, errors.New("failed"))
+	tracing.End(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+
+	for _, span := range spans {
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("span %q: expected trace ID %s, got %s", span.Name(), traceID, span.SpanContext().TraceID())
+		}
+	}
+
+	if spans[0].Name() != "child" || spans[0].Status().Code != codes.Error || spans[0].Status().Description != "failed" {
+		t.Errorf("expected failed child span, got %q with status %v", spans[0].Name(), spans[0].Status())
+	}
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("expected child span to be a child of the parent span")
+	}
+	if spans[1].Status().Code != codes.Unset {
+		t.Errorf("expected parent span status to be unset, got %v", spans[1].Status())
+	}
+
+	if _, ok := tracing.TraceID(t.Context()); ok {
+		t.Errorf("expected no trace ID without a span")
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+)
+
+const (
+	// InjectAnnotation is the Pod annotation naming the bundle to inject
+	InjectAnnotation = attributes.Prefix + "inject"
+	// InjectProfileAnnotation is the Pod annotation naming the injection
+	// profile, if unset the default profile is used
+	InjectProfileAnnotation = attributes.Prefix + "inject-profile"
+
+	// InjectVolumeName is the name of the volume added to the Pod
+	InjectVolumeName = "trust-manager-csi-driver"
+)
+
+// PodMutator adds the trust bundle volume to Pods annotated with
+// InjectAnnotation, and mounts it into every container at the paths of the
+// injection profile.
+type PodMutator struct {
+	DriverName     string
+	Profiles       map[string]InjectProfile
+	DefaultProfile string
+}
+
+var _ admission.Defaulter[*corev1.Pod] = &PodMutator{}
+
+func (m *PodMutator) Default(_ context.Context, pod *corev1.Pod) error {
+	bundle, ok := pod.Annotations[InjectAnnotation]
+	if !ok {
+		return nil
+	}
+
+	// The webhook may be called again if another webhook changes the Pod
+	for _, volume := range pod.Spec.Volumes {
+		if volume.Name == InjectVolumeName {
+			return nil
+		}
+	}
+
+	profileName := m.DefaultProfile
+	if name, ok := pod.Annotations[InjectProfileAnnotation]; ok {
+		profileName = name
+	}
+
+	profile, ok := m.Profiles[profileName]
+	if !ok {
+		return fmt.Errorf("unknown injection profile %q in annotation %s, must be one of: %s",
+			profileName, InjectProfileAnnotation, strings.Join(m.profileNames(), ", "))
+	}
+
+	attrs, err := profile.volumeAttributes(bundle)
+	if err != nil {
+		return fmt.Errorf("invalid bundle in annotation %s: %w", InjectAnnotation, err)
+	}
+
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: InjectVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			CSI: &corev1.CSIVolumeSource{
+				Driver:           m.DriverName,
+				ReadOnly:         ptr.To(true),
+				VolumeAttributes: attrs,
+			},
+		},
+	})
+
+	for i := range pod.Spec.InitContainers {
+		injectContainer(&pod.Spec.InitContainers[i], profile)
+	}
+	for i := range pod.Spec.Containers {
+		injectContainer(&pod.Spec.Containers[i], profile)
+	}
+
+	return nil
+}
+
+// injectContainer mounts the volume into the container and sets the profile
+// environment variables. Existing mounts and environment variables of the
+// container take precedence over the profile.
+func injectContainer(container *corev1.Container, profile InjectProfile) {
+	for _, mount := range profile.Mounts {
+		if hasMountPath(container, mount.MountPath) {
+			continue
+		}
+
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      InjectVolumeName,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+			ReadOnly:  true,
+		})
+	}
+
+	for _, env := range profile.Env {
+		if hasEnv(container, env.Name) {
+			continue
+		}
+
+		container.Env = append(container.Env, env)
+	}
+}
+
+func hasMountPath(container *corev1.Container, mountPath string) bool {
+	for _, mount := range container.VolumeMounts {
+		if mount.MountPath == mountPath {
+			return true
+		}
+	}
+	return false
+}
+
+func hasEnv(container *corev1.Container, name string) bool {
+	for _, env := range container.Env {
+		if env.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *PodMutator) profileNames() []string {
+	names := make([]string, 0, len(m.Profiles))
+	for name := range m.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
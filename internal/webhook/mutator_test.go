@@ -0,0 +1,219 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/webhook"
+)
+
+func TestPodMutator(t *testing.T) {
+	mutator := &webhook.PodMutator{
+		DriverName:     "csi.trust-manager.io",
+		Profiles:       webhook.DefaultInjectProfiles(),
+		DefaultProfile: "debian",
+	}
+
+	pod := func(annotations map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Annotations: annotations},
+			Spec: corev1.PodSpec{
+				InitContainers: []corev1.Container{{Name: "init"}},
+				Containers: []corev1.Container{
+					{Name: "app"},
+					{
+						Name: "custom",
+						Env:  []corev1.EnvVar{{Name: "SSL_CERT_FILE", Value: "/custom.crt"}},
+						VolumeMounts: []corev1.VolumeMount{
+							{Name: "custom", MountPath: "/etc/ssl/certs"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("not_annotated", func(t *testing.T) {
+		p := pod(nil)
+		if err := mutator.Default(t.Context(), p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(p, pod(nil)) {
+			t.Fatalf("expected pod to be unchanged, got %v", p)
+		}
+	})
+
+	t.Run("default_profile", func(t *testing.T) {
+		p := pod(map[string]string{webhook.InjectAnnotation: "example"})
+		if err := mutator.Default(t.Context(), p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		if len(p.Spec.Volumes) != 1 || p.Spec.Volumes[0].Name != webhook.InjectVolumeName {
+			t.Fatalf("expected inject volume to be added, got %v", p.Spec.Volumes)
+		}
+
+		attrs, err := attributes.Parse(p.Spec.Volumes[0].CSI.VolumeAttributes)
+		if err != nil {
+			t.Fatalf("expected valid volume attributes, got %s", err)
+		}
+		if attrs.Bundle != "example" {
+			t.Fatalf("expected bundle %q, got %q", "example", attrs.Bundle)
+		}
+
+		for _, c := range []corev1.Container{p.Spec.InitContainers[0], p.Spec.Containers[0]} {
+			expectMounts := []corev1.VolumeMount{{Name: webhook.InjectVolumeName, MountPath: "/etc/ssl/certs", ReadOnly: true}}
+			if !reflect.DeepEqual(c.VolumeMounts, expectMounts) {
+				t.Errorf("container %s: expected mounts %v, got %v", c.Name, expectMounts, c.VolumeMounts)
+			}
+			if len(c.Env) != 2 {
+				t.Errorf("container %s: expected SSL_CERT_DIR and SSL_CERT_FILE to be set, got %v", c.Name, c.Env)
+			}
+		}
+
+		// Existing mounts and env of the container are kept
+		custom := p.Spec.Containers[1]
+		if len(custom.VolumeMounts) != 1 || custom.VolumeMounts[0].Name != "custom" {
+			t.Errorf("expected custom mount to be kept, got %v", custom.VolumeMounts)
+		}
+		expectEnv := []corev1.EnvVar{
+			{Name: "SSL_CERT_FILE", Value: "/custom.crt"},
+			{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs"},
+		}
+		if !reflect.DeepEqual(custom.Env, expectEnv) {
+			t.Errorf("expected env %v, got %v", expectEnv, custom.Env)
+		}
+
+		// Calling the webhook again doesn't change the pod
+		expected := p.DeepCopy()
+		if err := mutator.Default(t.Context(), p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(p, expected) {
+			t.Fatalf("expected pod to be unchanged on reinvocation")
+		}
+	})
+
+	t.Run("rhel_profile", func(t *testing.T) {
+		p := pod(map[string]string{webhook.InjectAnnotation: "example", webhook.InjectProfileAnnotation: "rhel"})
+		if err := mutator.Default(t.Context(), p); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+
+		mounts := p.Spec.Containers[0].VolumeMounts
+		if len(mounts) != 1 || mounts[0].MountPath != "/etc/pki/ca-trust/extracted" {
+			t.Fatalf("expected volume to be mounted at /etc/pki/ca-trust/extracted, got %v", mounts)
+		}
+	})
+
+	t.Run("unknown_profile", func(t *testing.T) {
+		p := pod(map[string]string{webhook.InjectAnnotation: "example", webhook.InjectProfileAnnotation: "windows"})
+		err := mutator.Default(t.Context(), p)
+		if err == nil || !strings.Contains(err.Error(), `unknown injection profile "windows"`) {
+			t.Fatalf("expected unknown profile error, got %v", err)
+		}
+	})
+
+	t.Run("invalid_bundle", func(t *testing.T) {
+		p := pod(map[string]string{webhook.InjectAnnotation: "Not_Valid"})
+		if err := mutator.Default(t.Context(), p); err == nil {
+			t.Fatalf("expected error for invalid bundle name")
+		}
+	})
+}
+
+func TestLoadInjectProfiles(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Profiles  string
+		ExpectErr string
+	}{
+		{
+			Name: "valid",
+			Profiles: `
+profiles:
+  java:
+    outputs:
+    - format: ConcatenatedFile
+      path: /ca-certificates.crt
+      mode: 0444
+    mounts:
+    - mountPath: /certificates
+    env:
+    - name: USE_SYSTEM_CA_CERTS
+      value: "1"
+`,
+		},
+		{
+			Name: "unknown_field",
+			Profiles: `
+profiles:
+  java:
+    mountPath: /certificates
+`,
+			ExpectErr: `unknown field "mountPath"`,
+		},
+		{
+			Name: "invalid_profile",
+			Profiles: `
+profiles:
+  broken:
+    outputs:
+    - format: ConcatenatedFile
+      path: /ca.crt
+    mounts:
+    - mountPath: certs
+`,
+			ExpectErr: `profiles[broken].mounts[0].mountPath: Invalid value: "certs": must be an absolute path`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "profiles.yaml")
+			if err := os.WriteFile(file, []byte(test.Profiles), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			profiles, err := webhook.LoadInjectProfiles(file)
+			if test.ExpectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.ExpectErr) {
+					t.Fatalf("expected error containing %q, got %v", test.ExpectErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for _, name := range []string{"debian", "alpine", "rhel", "java"} {
+				if _, ok := profiles[name]; !ok {
+					t.Errorf("expected profile %q to exist", name)
+				}
+			}
+		})
+	}
+}
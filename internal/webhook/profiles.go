@@ -0,0 +1,183 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/api/metadata"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+)
+
+// InjectProfile describes how a trust bundle is injected into the containers
+// of a Pod, so that it replaces the CA certificates of the container image.
+type InjectProfile struct {
+	// Outputs written to the volume, paths are relative to the root of the
+	// volume.
+	Outputs []attributes.Output `json:"outputs"`
+	// Mounts of the volume in every container.
+	Mounts []InjectMount `json:"mounts"`
+	// Env is set on every container, unless the container already sets the
+	// variable.
+	Env []corev1.EnvVar `json:"env,omitempty"`
+}
+
+// InjectMount is a mount of the injected volume.
+type InjectMount struct {
+	// MountPath is the absolute path in the container.
+	MountPath string `json:"mountPath"`
+	// SubPath in the volume to mount, defaults to the root of the volume.
+	SubPath string `json:"subPath,omitempty"`
+}
+
+// InjectProfiles is the format of the injection profiles file.
+type InjectProfiles struct {
+	Profiles map[string]InjectProfile `json:"profiles"`
+}
+
+// DefaultInjectProfiles are the built-in injection profiles, they match the CA
+// certificate layouts of common base images.
+func DefaultInjectProfiles() map[string]InjectProfile {
+	// Alpine uses the same layout as Debian, /etc/ssl/cert.pem is a symlink to
+	// /etc/ssl/certs/ca-certificates.crt
+	debian := InjectProfile{
+		Outputs: []attributes.Output{
+			{Format: metadata.OutputFormatOpenSSLRehash, Path: "/", Mode: ptr.To[int32](0444)},
+			{Format: metadata.OutputFormatConcatenatedFile, Path: "/ca-certificates.crt", Mode: ptr.To[int32](0444)},
+		},
+		Mounts: []InjectMount{{MountPath: "/etc/ssl/certs"}},
+		Env: []corev1.EnvVar{
+			{Name: "SSL_CERT_DIR", Value: "/etc/ssl/certs"},
+			{Name: "SSL_CERT_FILE", Value: "/etc/ssl/certs/ca-certificates.crt"},
+		},
+	}
+
+	return map[string]InjectProfile{
+		"debian": debian,
+		"alpine": debian,
+		// /etc/pki/tls/certs/ca-bundle.crt and /etc/pki/tls/cert.pem are
+		// symlinks into /etc/pki/ca-trust/extracted
+		"rhel": {
+			Outputs: []attributes.Output{
+				{Format: metadata.OutputFormatOpenSSLRehash, Path: "/pem/directory-hash", Mode: ptr.To[int32](0444)},
+				{Format: metadata.OutputFormatConcatenatedFile, Path: "/pem/tls-ca-bundle.pem", Mode: ptr.To[int32](0444)},
+			},
+			Mounts: []InjectMount{{MountPath: "/etc/pki/ca-trust/extracted"}},
+			Env: []corev1.EnvVar{
+				{Name: "SSL_CERT_DIR", Value: "/etc/pki/ca-trust/extracted/pem/directory-hash"},
+				{Name: "SSL_CERT_FILE", Value: "/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem"},
+			},
+		},
+	}
+}
+
+// LoadInjectProfiles reads the injection profiles from the file, the profiles
+// are added to the built-in profiles and replace built-in profiles with the
+// same name.
+func LoadInjectProfiles(file string) (map[string]InjectProfile, error) {
+	profiles := DefaultInjectProfiles()
+	if file == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read injection profiles: %w", err)
+	}
+
+	var loaded InjectProfiles
+	if err := yaml.UnmarshalStrict(data, &loaded); err != nil {
+		return nil, fmt.Errorf("failed to parse injection profiles %q: %w", file, err)
+	}
+
+	var errs field.ErrorList
+	names := make([]string, 0, len(loaded.Profiles))
+	for name := range loaded.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		errs = append(errs, validateInjectProfile(field.NewPath("profiles").Key(name), loaded.Profiles[name])...)
+		profiles[name] = loaded.Profiles[name]
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid injection profiles %q: %w", file, errs.ToAggregate())
+	}
+
+	return profiles, nil
+}
+
+func validateInjectProfile(fldPath *field.Path, profile InjectProfile) field.ErrorList {
+	var errs field.ErrorList
+
+	// The outputs are validated the same way as the volume attributes the
+	// webhook will generate from them.
+	if _, err := profile.volumeAttributes("profile"); err != nil {
+		errs = append(errs, field.Invalid(fldPath.Child("outputs"), profile.Outputs, err.Error()))
+	}
+
+	if len(profile.Mounts) == 0 {
+		errs = append(errs, field.Required(fldPath.Child("mounts"), ""))
+	}
+	for i, mount := range profile.Mounts {
+		if !path.IsAbs(mount.MountPath) {
+			errs = append(errs, field.Invalid(fldPath.Child("mounts").Index(i).Child("mountPath"), mount.MountPath, "must be an absolute path"))
+		}
+		if path.IsAbs(mount.SubPath) {
+			errs = append(errs, field.Invalid(fldPath.Child("mounts").Index(i).Child("subPath"), mount.SubPath, "must be a relative path"))
+		}
+	}
+
+	for i, env := range profile.Env {
+		if env.Name == "" {
+			errs = append(errs, field.Required(fldPath.Child("env").Index(i).Child("name"), ""))
+		}
+	}
+
+	return errs
+}
+
+// volumeAttributes returns the CSI volume attributes to mount the bundle with
+// the profile.
+func (p InjectProfile) volumeAttributes(bundle string) (map[string]string, error) {
+	outputs, err := json.Marshal(p.Outputs)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{
+		attributes.BundleKey:  bundle,
+		attributes.OutputsKey: string(outputs),
+	}
+
+	if _, err := attributes.Parse(attrs); err != nil {
+		return nil, err
+	}
+
+	return attrs, nil
+}
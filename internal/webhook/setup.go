@@ -0,0 +1,55 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook contains the admission webhooks for Pods using the CSI
+// driver. The webhooks are optional and run as a separate deployment from the
+// CSI driver itself.
+package webhook
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+)
+
+const (
+	// ValidatePath is the path the validating webhook is served on
+	ValidatePath = "/validate-pod"
+	// MutatePath is the path the mutating webhook is served on
+	MutatePath = "/mutate-pod"
+)
+
+// SetupValidating registers the validating webhook on the manager's webhook
+// server. Volumes are checked against the policy, which should be the same
+// policy the CSI driver enforces.
+func SetupValidating(mgr ctrl.Manager, driverName string, policy *policy.Policy) {
+	mgr.GetWebhookServer().Register(ValidatePath, admission.WithValidator[*corev1.Pod](mgr.GetScheme(), &PodValidator{
+		DriverName: driverName,
+		Client:     mgr.GetClient(),
+		Policy:     policy,
+	}))
+}
+
+// SetupMutating registers the mutating webhook on the manager's webhook server.
+func SetupMutating(mgr ctrl.Manager, driverName string, profiles map[string]InjectProfile, defaultProfile string) {
+	mgr.GetWebhookServer().Register(MutatePath, admission.WithDefaulter[*corev1.Pod](mgr.GetScheme(), &PodMutator{
+		DriverName:     driverName,
+		Profiles:       profiles,
+		DefaultProfile: defaultProfile,
+	}))
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"fmt"
+
+	trustv1alpha1 "github.com/cert-manager/trust-manager/pkg/apis/trust/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/attributes"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+)
+
+// PodValidator validates the inline CSI volumes of Pods using the driver. This
+// surfaces mistakes when the Pod is created, instead of leaving the Pod stuck
+// in ContainerCreating after NodePublishVolume fails on the node.
+type PodValidator struct {
+	DriverName string
+	Client     client.Reader
+	// Policy declares which namespaces may mount which Bundles, nil allows
+	// every Bundle.
+	Policy *policy.Policy
+}
+
+var _ admission.Validator[*corev1.Pod] = &PodValidator{}
+
+func (v *PodValidator) ValidateCreate(ctx context.Context, pod *corev1.Pod) (admission.Warnings, error) {
+	return nil, v.validate(ctx, pod)
+}
+
+// ValidateUpdate is a no-op, the volumes of a Pod are immutable so they have
+// already been validated on create.
+func (v *PodValidator) ValidateUpdate(context.Context, *corev1.Pod, *corev1.Pod) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *PodValidator) ValidateDelete(context.Context, *corev1.Pod) (admission.Warnings, error) {
+	return nil, nil
+}
+
+func (v *PodValidator) validate(ctx context.Context, pod *corev1.Pod) error {
+	// Pods created by controllers do not have the namespace set in the object,
+	// it is only set on the admission request.
+	namespace := pod.Namespace
+	if req, err := admission.RequestFromContext(ctx); err == nil && req.Namespace != "" {
+		namespace = req.Namespace
+	}
+
+	var errs field.ErrorList
+	for i, volume := range pod.Spec.Volumes {
+		if volume.CSI == nil || volume.CSI.Driver != v.DriverName {
+			continue
+		}
+
+		errs = append(errs, v.validateVolume(ctx, field.NewPath("spec", "volumes").Index(i).Child("csi"), namespace, volume.CSI)...)
+	}
+
+	if len(errs) > 0 {
+		return apierrors.NewInvalid(corev1.SchemeGroupVersion.WithKind("Pod").GroupKind(), pod.Name, errs)
+	}
+
+	return nil
+}
+
+func (v *PodValidator) validateVolume(ctx context.Context, fldPath *field.Path, namespace string, volume *corev1.CSIVolumeSource) field.ErrorList {
+	var errs field.ErrorList
+
+	// This mirrors the checks done by the NodeServer
+	if volume.ReadOnly == nil || !*volume.ReadOnly {
+		errs = append(errs, field.Required(fldPath.Child("readOnly"), "must be set to true"))
+	}
+
+	attrsPath := fldPath.Child("volumeAttributes")
+	attrs, attrErrs := attributes.ParseAt(attrsPath, volume.VolumeAttributes)
+	errs = append(errs, attrErrs...)
+
+	// The attributes must be valid before we can look up the bundle
+	if len(attrErrs) > 0 {
+		return errs
+	}
+
+	if !v.Policy.Allowed(namespace, attrs.Bundle) {
+		return append(errs, field.Forbidden(attrsPath.Key(attributes.BundleKey), fmt.Sprintf("bundle %q may not be mounted in namespace %q by the policy", attrs.Bundle, namespace)))
+	}
+
+	return append(errs, v.validateBundle(ctx, attrsPath.Key(attributes.BundleKey), namespace, attrs.Bundle)...)
+}
+
+// validateBundle checks the bundle exists and is synced to the namespace of the
+// Pod by trust-manager.
+func (v *PodValidator) validateBundle(ctx context.Context, fldPath *field.Path, namespace, name string) field.ErrorList {
+	var bundle trustv1alpha1.Bundle
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: name}, &bundle); err != nil {
+		if apierrors.IsNotFound(err) {
+			return field.ErrorList{field.NotFound(fldPath, name)}
+		}
+
+		return field.ErrorList{field.InternalError(fldPath, fmt.Errorf("could not get bundle: %w", err))}
+	}
+
+	if bundle.Spec.Target.NamespaceSelector == nil {
+		return nil
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(bundle.Spec.Target.NamespaceSelector)
+	if err != nil {
+		return field.ErrorList{field.InternalError(fldPath, fmt.Errorf("bundle has an invalid namespace selector: %w", err))}
+	}
+
+	var ns corev1.Namespace
+	if err := v.Client.Get(ctx, client.ObjectKey{Name: namespace}, &ns); err != nil {
+		return field.ErrorList{field.InternalError(fldPath, fmt.Errorf("could not get namespace: %w", err))}
+	}
+
+	if !selector.Matches(labels.Set(ns.Labels)) {
+		return field.ErrorList{field.Forbidden(fldPath, fmt.Sprintf("bundle %q is not synced to namespace %q by trust-manager, see the bundle spec.target.namespaceSelector", name, namespace))}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2024 The cert-manager Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook_test
+
+import (
+	"strings"
+	"testing"
+
+	trustv1alpha1 "github.com/cert-manager/trust-manager/pkg/apis/trust/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/cert-manager/trust-manager-csi-driver/internal/driver/policy"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/scheme"
+	"github.com/cert-manager/trust-manager-csi-driver/internal/webhook"
+)
+
+func TestPodValidator(t *testing.T) {
+	const driverName = "csi.trust-manager.io"
+
+	objects := []runtime.Object{
+		&trustv1alpha1.Bundle{ObjectMeta: metav1.ObjectMeta{Name: "public"}},
+		&trustv1alpha1.Bundle{ObjectMeta: metav1.ObjectMeta{Name: "restricted"}},
+		&trustv1alpha1.Bundle{
+			ObjectMeta: metav1.ObjectMeta{Name: "private"},
+			Spec: trustv1alpha1.BundleSpec{
+				Target: trustv1alpha1.BundleTarget{
+					NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"team": "a"}},
+				},
+			},
+		},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"team": "a"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-b", Labels: map[string]string{"team": "b"}}},
+	}
+
+	validator := &webhook.PodValidator{
+		DriverName: driverName,
+		Client:     fake.NewClientBuilder().WithScheme(scheme.New()).WithRuntimeObjects(objects...).Build(),
+		Policy: &policy.Policy{
+			Rules: []policy.Rule{
+				{Bundles: []string{"public", "private", "missing"}, Namespaces: []string{"*"}},
+				{Bundles: []string{"restricted"}, Namespaces: []string{"team-a"}},
+			},
+		},
+	}
+
+	pod := func(namespace string, volumes ...corev1.Volume) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "example", Namespace: namespace},
+			Spec:       corev1.PodSpec{Volumes: volumes},
+		}
+	}
+
+	volume := func(driver string, readOnly bool, attrs map[string]string) corev1.Volume {
+		return corev1.Volume{
+			Name: "trust",
+			VolumeSource: corev1.VolumeSource{
+				CSI: &corev1.CSIVolumeSource{Driver: driver, ReadOnly: ptr.To(readOnly), VolumeAttributes: attrs},
+			},
+		}
+	}
+
+	tests := []struct {
+		Name       string
+		Pod        *corev1.Pod
+		ExpectErrs []string
+	}{
+		{
+			Name: "valid_volume",
+			Pod: pod("team-b", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "public",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+		},
+		{
+			Name: "other_driver_ignored",
+			Pod:  pod("team-b", volume("other.csi.io", false, nil)),
+		},
+		{
+			Name: "bundle_allowed_for_namespace",
+			Pod: pod("team-a", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "private",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+		},
+		{
+			Name: "bundle_not_allowed_for_namespace",
+			Pod: pod("team-b", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "private",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+			ExpectErrs: []string{
+				`spec.volumes[0].csi.volumeAttributes[trust.cert-manager.io/bundle]: Forbidden: bundle "private" is not synced to namespace "team-b"`,
+			},
+		},
+		{
+			Name: "bundle_allowed_by_policy",
+			Pod: pod("team-a", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "restricted",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+		},
+		{
+			Name: "bundle_denied_by_policy",
+			Pod: pod("team-b", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "restricted",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+			ExpectErrs: []string{
+				`spec.volumes[0].csi.volumeAttributes[trust.cert-manager.io/bundle]: Forbidden: bundle "restricted" may not be mounted in namespace "team-b" by the policy`,
+			},
+		},
+		{
+			Name: "missing_bundle",
+			Pod: pod("team-b", volume(driverName, true, map[string]string{
+				"trust.cert-manager.io/bundle":         "missing",
+				"trust.cert-manager.io/openssl-rehash": "/",
+			})),
+			ExpectErrs: []string{
+				`spec.volumes[0].csi.volumeAttributes[trust.cert-manager.io/bundle]: Not found: "missing"`,
+			},
+		},
+		{
+			Name: "invalid_volume",
+			Pod: pod("team-b", volume(driverName, false, map[string]string{
+				"trust.cert-manager.io/bundle":           "public",
+				"trust.cert-manager.io/openssl-rehashes": "/",
+			})),
+			ExpectErrs: []string{
+				"spec.volumes[0].csi.readOnly: Required value",
+				"spec.volumes[0].csi.volumeAttributes[trust.cert-manager.io/openssl-rehashes]: Forbidden",
+				"spec.volumes[0].csi.volumeAttributes[trust.cert-manager.io/outputs]: Required value",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			_, err := validator.ValidateCreate(t.Context(), test.Pod)
+			if len(test.ExpectErrs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("expected error, got nil")
+			}
+
+			for _, expected := range test.ExpectErrs {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q, got %q", expected, err)
+				}
+			}
+		})
+	}
+}
@@ -42,7 +42,7 @@ deploy_name := trust-manager-csi-driver
 deploy_namespace := cert-manager
 
 # Code generation
-conversion_packages = internal/api/metadata/v1alpha1
+conversion_packages = internal/api/metadata/v1alpha1 internal/api/metadata/v1alpha2
 
 # api_docs_outfile := docs/api/api.md
 # api_docs_package := $(repo_name)/pkg/apis/trust/v1alpha1
@@ -24,4 +24,10 @@ test-unit: | $(NEEDS_GO) $(NEEDS_GOTESTSUM) $(ARTIFACTS)
 		-- \
 		-ldflags $(go_manager_ldflags)
 	
-	$(GO) tool cover -html=$(ARTIFACTS)/filtered.cov -o=$(ARTIFACTS)/filtered.html
\ No newline at end of file
+	$(GO) tool cover -html=$(ARTIFACTS)/filtered.cov -o=$(ARTIFACTS)/filtered.html
+
+.PHONY: test-race
+## Tests of concurrent volume operations with the race detector
+## @category Testing
+test-race: | $(NEEDS_GO)
+	$(GO) test -race -run 'Concurrent' ./internal/...
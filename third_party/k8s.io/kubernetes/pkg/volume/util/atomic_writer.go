@@ -139,6 +139,18 @@ const (
 //
 //  12. The previous timestamped directory is removed, if it exists.
 func (w *AtomicWriter) Write(payload map[string]FileProjection, setPerms func(subPath string) error) error {
+	return w.write(payload, setPerms, "")
+}
+
+// WriteLinked does an atomic projection of the given payload into the writer's
+// target directory like Write, but instead of writing the files they are hard
+// linked from sourceDir, which must already contain the payload. The payload
+// is projected again if any file is not a link to the file in sourceDir.
+func (w *AtomicWriter) WriteLinked(payload map[string]FileProjection, sourceDir string) error {
+	return w.write(payload, nil, sourceDir)
+}
+
+func (w *AtomicWriter) write(payload map[string]FileProjection, setPerms func(subPath string) error, sourceDir string) error {
 	// (1)
 	cleanPayload, err := validatePayload(payload)
 	if err != nil {
@@ -172,7 +184,7 @@ func (w *AtomicWriter) Write(payload map[string]FileProjection, setPerms func(su
 		}
 
 		// (4)
-		if should, err := shouldWritePayload(cleanPayload, oldTsPath); err != nil {
+		if should, err := shouldWritePayload(cleanPayload, oldTsPath, sourceDir); err != nil {
 			klog.Errorf("%s: error determining whether payload should be written to disk: %v", w.logContext, err)
 			return err
 		} else if !should && len(pathsToRemove) == 0 {
@@ -198,7 +210,7 @@ func (w *AtomicWriter) Write(payload map[string]FileProjection, setPerms func(su
 		tsDirName := filepath.Base(tsDir)
 
 		// (6)
-		if err = w.writePayloadToDir(cleanPayload, tsDir); err != nil {
+		if err = w.writePayloadToDir(cleanPayload, tsDir, sourceDir); err != nil {
 			klog.Errorf("%s: error writing payload to ts data directory %s: %v", w.logContext, tsDir, err)
 			return err
 		}
@@ -323,10 +335,24 @@ func validatePath(targetPath string) error {
 	return nil
 }
 
-// shouldWritePayload returns whether the payload should be written to disk.
-func shouldWritePayload(payload map[string]FileProjection, oldTsDir string) (bool, error) {
+// shouldWritePayload returns whether the payload should be written to disk. If
+// sourceDir is set the files must be links to the files in sourceDir.
+func shouldWritePayload(payload map[string]FileProjection, oldTsDir string, sourceDir string) (bool, error) {
 	for userVisiblePath, fileProjection := range payload {
-		shouldWrite, err := shouldWriteFile(filepath.Join(oldTsDir, userVisiblePath), fileProjection.Data)
+		if sourceDir != "" {
+			shouldLink, err := shouldLinkFile(filepath.Join(oldTsDir, userVisiblePath), filepath.Join(sourceDir, userVisiblePath))
+			if err != nil {
+				return false, err
+			}
+
+			if shouldLink {
+				return true, nil
+			}
+
+			continue
+		}
+
+		shouldWrite, err := shouldWriteFile(filepath.Join(oldTsDir, userVisiblePath), fileProjection)
 		if err != nil {
 			return false, err
 		}
@@ -339,19 +365,57 @@ func shouldWritePayload(payload map[string]FileProjection, oldTsDir string) (boo
 	return false, nil
 }
 
-// shouldWriteFile returns whether a new version of a file should be written to disk.
-func shouldWriteFile(path string, content []byte) (bool, error) {
-	_, err := os.Lstat(path)
+// shouldWriteFile returns whether a new version of a file should be written to disk,
+// because its content or mode differ from the projection.
+func shouldWriteFile(path string, fileProjection FileProjection) (bool, error) {
+	info, err := os.Lstat(path)
 	if os.IsNotExist(err) {
 		return true, nil
 	}
+	if err != nil {
+		return false, err
+	}
+
+	if !info.Mode().IsRegular() || info.Mode().Perm() != os.FileMode(fileProjection.Mode).Perm() || !OwnerMatches(info, fileProjection) {
+		return true, nil
+	}
 
 	contentOnFs, err := os.ReadFile(path)
 	if err != nil {
 		return false, err
 	}
 
-	return !bytes.Equal(content, contentOnFs), nil
+	return !bytes.Equal(fileProjection.Data, contentOnFs), nil
+}
+
+// OwnerMatches returns whether the file is owned by the user and group of the
+// projection, only the ids set in the projection are compared.
+func OwnerMatches(info os.FileInfo, fileProjection FileProjection) bool {
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return true
+	}
+
+	return (fileProjection.FsUser == nil || *fileProjection.FsUser == uid) &&
+		(fileProjection.FsGroup == nil || *fileProjection.FsGroup == gid)
+}
+
+// shouldLinkFile returns whether the file is not a link to the source file.
+func shouldLinkFile(path string, source string) (bool, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sourceInfo, err := os.Stat(source)
+	if err != nil {
+		return false, err
+	}
+
+	return !os.SameFile(info, sourceInfo), nil
 }
 
 // pathsToRemove walks the current version of the data directory and
@@ -418,7 +482,7 @@ func (w *AtomicWriter) newTimestampDir() (string, error) {
 
 // writePayloadToDir writes the given payload to the given directory.  The
 // directory must exist.
-func (w *AtomicWriter) writePayloadToDir(payload map[string]FileProjection, dir string) error {
+func (w *AtomicWriter) writePayloadToDir(payload map[string]FileProjection, dir string, sourceDir string) error {
 	for userVisiblePath, fileProjection := range payload {
 		content := fileProjection.Data
 		mode := os.FileMode(fileProjection.Mode)
@@ -430,6 +494,15 @@ func (w *AtomicWriter) writePayloadToDir(payload map[string]FileProjection, dir
 			return err
 		}
 
+		// The mode and owner are shared with the source file
+		if sourceDir != "" {
+			if err := os.Link(filepath.Join(sourceDir, userVisiblePath), fullPath); err != nil {
+				klog.Errorf("%s: unable to link file %s: %v", w.logContext, fullPath, err)
+				return err
+			}
+			continue
+		}
+
 		if err := os.WriteFile(fullPath, content, mode); err != nil {
 			klog.Errorf("%s: unable to write file %s with mode %v: %v", w.logContext, fullPath, mode, err)
 			return err
@@ -443,14 +516,15 @@ func (w *AtomicWriter) writePayloadToDir(payload map[string]FileProjection, dir
 			return err
 		}
 
-		if fileProjection.FsUser == nil {
+		// Either id may be set on its own, the other is left unchanged
+		if fileProjection.FsUser == nil && fileProjection.FsGroup == nil {
 			continue
 		}
 
 		uid := ptr.Deref(fileProjection.FsUser, -1)
 		gid := ptr.Deref(fileProjection.FsGroup, -1)
 		if err := w.chown(fullPath, int(uid), int(gid)); err != nil {
-			klog.Errorf("%s: unable to change file %s with owner %v: %v", w.logContext, fullPath, int(*fileProjection.FsUser), err)
+			klog.Errorf("%s: unable to change file %s with owner %v:%v: %v", w.logContext, fullPath, uid, gid, err)
 			return err
 		}
 	}
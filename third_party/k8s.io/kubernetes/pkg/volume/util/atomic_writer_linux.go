@@ -19,9 +19,21 @@ limitations under the License.
 
 package util
 
-import "os"
+import (
+	"os"
+	"syscall"
+)
 
 // chown changes the numeric uid and gid of the named file.
 func (w *AtomicWriter) chown(name string, uid, gid int) error {
 	return os.Chown(name, uid, gid)
 }
+
+// fileOwner returns the numeric uid and gid of the file.
+func fileOwner(info os.FileInfo) (uid, gid int64, ok bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return int64(stat.Uid), int64(stat.Gid), true
+}
@@ -443,6 +443,16 @@ func TestUpdate(t *testing.T) {
 			},
 			shouldWrite: false,
 		},
+		{
+			name: "mode update",
+			first: map[string]FileProjection{
+				"foo": {Mode: 0644, Data: []byte("foo")},
+			},
+			next: map[string]FileProjection{
+				"foo": {Mode: 0400, Data: []byte("foo")},
+			},
+			shouldWrite: true,
+		},
 		{
 			name: "no update 2",
 			first: map[string]FileProjection{
@@ -600,6 +610,176 @@ func TestUpdate(t *testing.T) {
 	}
 }
 
+func TestWriteCorrectsDrift(t *testing.T) {
+	payload := map[string]FileProjection{
+		"foo":         {Mode: 0644, Data: []byte("foo")},
+		"bar/zab.txt": {Mode: 0644, Data: []byte("bar")},
+	}
+
+	cases := []struct {
+		name  string
+		drift func(dataDir string) error
+	}{
+		{
+			name:  "modified",
+			drift: func(dataDir string) error { return os.WriteFile(filepath.Join(dataDir, "foo"), []byte("bad"), 0644) },
+		},
+		{
+			name:  "deleted",
+			drift: func(dataDir string) error { return os.Remove(filepath.Join(dataDir, "bar", "zab.txt")) },
+		},
+		{
+			name:  "chmod",
+			drift: func(dataDir string) error { return os.Chmod(filepath.Join(dataDir, "foo"), 0600) },
+		},
+		{
+			name: "symlink deleted",
+			drift: func(dataDir string) error {
+				return os.Remove(filepath.Join(filepath.Dir(dataDir), "foo"))
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		targetDir := t.TempDir()
+		writer := &AtomicWriter{targetDir: targetDir, logContext: "-test-"}
+
+		if err := writer.Write(payload, nil); err != nil {
+			t.Fatalf("%v: unexpected error writing: %v", tc.name, err)
+		}
+
+		if err := tc.drift(filepath.Join(targetDir, dataDirName)); err != nil {
+			t.Fatalf("%v: unexpected error drifting: %v", tc.name, err)
+		}
+
+		if err := writer.Write(payload, nil); err != nil {
+			t.Fatalf("%v: unexpected error writing: %v", tc.name, err)
+		}
+
+		checkVolumeContents(targetDir, tc.name, payload, t)
+	}
+}
+
+func TestWriteOwner(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("changing the owner of files requires root")
+	}
+
+	gid := func(id int64) *int64 { return &id }
+	uid := int64(os.Getuid())
+
+	targetDir := t.TempDir()
+	writer := &AtomicWriter{targetDir: targetDir, logContext: "-test-"}
+
+	checkOwner := func(name string, expectedGid int64) {
+		info, err := os.Stat(filepath.Join(targetDir, "foo"))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", name, err)
+		}
+		fileUid, fileGid, ok := fileOwner(info)
+		if !ok {
+			t.Fatalf("%v: could not get the owner of the file", name)
+		}
+		if fileUid != uid || fileGid != expectedGid {
+			t.Errorf("%v: expected owner %v:%v, got %v:%v", name, uid, expectedGid, fileUid, fileGid)
+		}
+	}
+
+	// Only the group is set, the user is left unchanged
+	payload := map[string]FileProjection{"foo": {Mode: 0440, Data: []byte("foo"), FsGroup: gid(1234)}}
+	if err := writer.Write(payload, nil); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkOwner("group only", 1234)
+
+	// A different group for the same contents is applied
+	payload = map[string]FileProjection{"foo": {Mode: 0440, Data: []byte("foo"), FsGroup: gid(5678)}}
+	if err := writer.Write(payload, nil); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkOwner("group changed", 5678)
+
+	// The group changed on disk is corrected
+	if err := os.Chown(filepath.Join(targetDir, dataDirName, "foo"), -1, 1234); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Write(payload, nil); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkOwner("group drifted", 5678)
+}
+
+func TestWriteLinked(t *testing.T) {
+	payload := map[string]FileProjection{
+		"foo":         {Mode: 0644, Data: []byte("foo")},
+		"bar/zab.txt": {Mode: 0600, Data: []byte("bar")},
+	}
+
+	writeSource := func(dir string) {
+		for fpath, file := range payload {
+			fullPath := filepath.Join(dir, fpath)
+			if err := os.MkdirAll(filepath.Dir(fullPath), 0700); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(fullPath, file.Data, os.FileMode(file.Mode)); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(fullPath, os.FileMode(file.Mode)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	checkLinked := func(targetDir, sourceDir string) {
+		for fpath := range payload {
+			target, err := os.Stat(filepath.Join(targetDir, fpath))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			source, err := os.Stat(filepath.Join(sourceDir, fpath))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !os.SameFile(target, source) {
+				t.Errorf("expected %v to be linked to %v", fpath, sourceDir)
+			}
+		}
+	}
+
+	sourceDir := t.TempDir()
+	writeSource(sourceDir)
+
+	targetDir := t.TempDir()
+	writer := &AtomicWriter{targetDir: targetDir, logContext: "-test-"}
+
+	if err := writer.WriteLinked(payload, sourceDir); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkVolumeContents(targetDir, "linked", payload, t)
+	checkLinked(targetDir, sourceDir)
+
+	// Nothing changed, the data directory must be kept
+	dataDir, err := os.Readlink(filepath.Join(targetDir, dataDirName))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := writer.WriteLinked(payload, sourceDir); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	if newDataDir, _ := os.Readlink(filepath.Join(targetDir, dataDirName)); newDataDir != dataDir {
+		t.Errorf("expected data directory %v to be kept, got %v", dataDir, newDataDir)
+	}
+
+	// Files with the same contents from another source are linked again
+	newSourceDir := t.TempDir()
+	writeSource(newSourceDir)
+	if err := writer.WriteLinked(payload, newSourceDir); err != nil {
+		t.Fatalf("unexpected error writing: %v", err)
+	}
+	checkVolumeContents(targetDir, "relinked", payload, t)
+	checkLinked(targetDir, newSourceDir)
+}
+
 func TestMultipleUpdates(t *testing.T) {
 	cases := []struct {
 		name     string
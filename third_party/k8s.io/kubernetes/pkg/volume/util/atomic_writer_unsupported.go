@@ -20,6 +20,7 @@ limitations under the License.
 package util
 
 import (
+	"os"
 	"runtime"
 
 	"k8s.io/klog/v2"
@@ -31,3 +32,9 @@ func (w *AtomicWriter) chown(name string, uid, _ /* gid */ int) error {
 	klog.Warningf("%s: skipping change of Linux owner %v for file %s; unsupported on %s", w.logContext, uid, name, runtime.GOOS)
 	return nil
 }
+
+// fileOwner returns the numeric uid and gid of the file.
+// The owner is unknown on unsupported platforms.
+func fileOwner(os.FileInfo) (uid, gid int64, ok bool) {
+	return 0, 0, false
+}